@@ -0,0 +1,195 @@
+package codec
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+ * Codec reads and writes the key = value pairs of a config file
+ * Keys are the REPLACE-ME keys of the template (eg: module "echo".foo) or vdex settings
+ * like environment. Values hold the terraform expression text (eg: "hello", 5, ["30","40"])
+ */
+type Codec interface {
+	// name of the format (txt, json, yaml)
+	Name() string
+	// file extensions handled by the codec, first one is used for new files
+	Extensions() []string
+	// parses the content of a config file
+	Decode(data []byte) (map[string]string, error)
+	// formats the values as a new config file
+	Encode(values map[string]string) ([]byte, error)
+	// updates the existing content of a config file with the values
+	Merge(existing []byte, values map[string]string) ([]byte, error)
+}
+
+// Registered codecs, first one is the default
+var codecs = []Codec{TextCodec{}, JSONCodec{}, YAMLCodec{}}
+
+/*
+ * Returns the codec for the format name or the file extension (with or without dot)
+ */
+func ForName(format string) (Codec, error) {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	for _, c := range codecs {
+		if c.Name() == format {
+			return c, nil
+		}
+		for _, ext := range c.Extensions() {
+			if ext == "."+format {
+				return c, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported config format %q", format)
+}
+
+/*
+ * Returns the codec selected by the extension of the file name
+ */
+func ForFile(name string) (Codec, error) {
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return nil, fmt.Errorf("config file %s has no extension", name)
+	}
+	return ForName(ext)
+}
+
+/*
+ * Returns the file name without the extension if the extension belongs to a codec
+ */
+func Base(name string) string {
+	ext := filepath.Ext(name)
+	if _, err := ForName(ext); err == nil && ext != "" {
+		return strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+/*
+ * Returns the file name with the extension of the codec
+ */
+func WithExt(name string, c Codec) string {
+	return Base(name) + c.Extensions()[0]
+}
+
+/*
+ * Finds the config file for the name in any of the supported formats
+ * The name itself is preferred when present
+ * Returns the path of the existing file, empty string if none exists
+ */
+func Locate(name string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+	base := Base(name)
+	for _, c := range codecs {
+		for _, ext := range c.Extensions() {
+			if _, err := os.Stat(base + ext); err == nil {
+				return base + ext
+			}
+		}
+	}
+	return ""
+}
+
+/*
+ * Returns true if the file name is a config file named base (eg: dev-config.txt for config.txt)
+ */
+func IsConfigFile(name string, base string) bool {
+	if Base(name) == name {
+		return false
+	}
+	return strings.HasSuffix(Base(name), Base(base))
+}
+
+/*
+ * Reads and decodes the config file as per its extension
+ */
+func ReadFile(name string) (map[string]string, error) {
+	c, err := ForFile(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		log.Println("Failed to read file:", name)
+		return nil, err
+	}
+	values, err := c.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return values, nil
+}
+
+/*
+ * Returns the content to be written to the config file name
+ * existing content is merged when the file is present
+ */
+func Format(name string, values map[string]string) ([]byte, error) {
+	c, err := ForFile(name)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := os.ReadFile(name)
+	if err != nil {
+		return c.Encode(values)
+	}
+	return c.Merge(existing, values)
+}
+
+/*
+ * Writes the values to the config file as per its extension
+ */
+func WriteFile(name string, values map[string]string) error {
+	data, err := Format(name, values)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0666)
+}
+
+/*
+ * Returns true if the key is a vdex setting (eg: environment) rather than a template key
+ * template keys are always qualified with the block name
+ */
+func IsSetting(key string) bool {
+	return !strings.Contains(key, ".")
+}
+
+// suffix of the key that holds the system name
+const SYSTEM_KEY_SUFFIX = "tags.\"System-Name\""
+
+/*
+ * Returns the keys in the order they are prompted/saved
+ * system name key comes first as it decides the config location,
+ * settings are at the end
+ */
+func SortKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := keyRank(keys[i]), keyRank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func keyRank(k string) int {
+	if strings.HasSuffix(k, SYSTEM_KEY_SUFFIX) {
+		return 0
+	} else if IsSetting(k) {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,55 @@
+package codec
+
+import (
+	"testing"
+)
+
+// values of every kind the parser finds in the templates
+var roundTripValues = map[string]string{
+	`module "echo".foo`:                              "5",
+	`module "echo".bar`:                              `"hello"`,
+	`module "echo".items`:                            `["30","40"]`,
+	`module "net".ratio`:                             "-1.5",
+	`module "net".enabled`:                           "true",
+	`module "net".owner`:                             "null",
+	`module "net".vpc_id`:                            "aws_vpc.main.id",
+	`module "net".name`:                              `"${local.prefix}-${var.env}"`,
+	`module "net".subnets`:                           "[for s in var.subnets : s.id]",
+	`module "net".tags`:                              "merge(local.tags, { env = var.env })",
+	`module "net".escaped`:                           `"Val \"50\""`,
+	`provider "aws".default_tags.tags."System-Name"`: `"REPLACE-ME"`,
+	`module "app".labels`:                            "{\n        app  = \"echo\"\n        tier = \"web\"\n    }",
+	`module "app".script`:                            "<<-EOT\n      #!/bin/bash\n      echo \"hello\"\n    EOT",
+	`module "app".name`:                              "format(\"%s-%s\",\n        \"app\",\n        \"dev\")",
+	`module "app".rules`:                             "[\n        { port = 443, cidr = [] },\n    ]",
+	`module "app".empty`:                             "",
+	`module "app".settings.retries`:                  "3",
+	`backend`:                                        "s3",
+	`template`:                                       "git::file:///srv/git/templates//modules/x?ref=v1.1.0",
+	`depends_on`:                                     `["iam", "network"]`,
+	`environment`:                                    "dev",
+}
+
+// the values survive the round trip through every config format
+func TestConfigRoundTrip(t *testing.T) {
+	for _, c := range codecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			data, err := c.Encode(roundTripValues)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			got, err := c.Decode(data)
+			if err != nil {
+				t.Fatalf("Decode failed: %v\n%s", err, data)
+			}
+			for k, v := range roundTripValues {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+			if len(got) != len(roundTripValues) {
+				t.Errorf("decoded %d values, want %d", len(got), len(roundTripValues))
+			}
+		})
+	}
+}
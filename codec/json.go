@@ -0,0 +1,67 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+/*
+ * JSONCodec stores the config as a single JSON object keyed by the config keys
+ * eg: {"module \"echo\".foo": 5, "environment": "dev"}
+ */
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Extensions() []string {
+	return []string{".json"}
+}
+
+func (JSONCodec) Decode(data []byte) (map[string]string, error) {
+	natives := make(map[string]interface{})
+	if len(bytes.TrimSpace(data)) == 0 {
+		return map[string]string{}, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&natives); err != nil {
+		return nil, err
+	}
+	return fromNativeMap(natives)
+}
+
+func (JSONCodec) Encode(values map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(toNativeMap(values)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+ * Keys present only in the existing content are retained
+ */
+func (c JSONCodec) Merge(existing []byte, values map[string]string) ([]byte, error) {
+	old, err := c.Decode(existing)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encode(mergeValues(old, values))
+}
+
+// values override the old values, keys only present in old are retained
+func mergeValues(old map[string]string, values map[string]string) map[string]string {
+	merged := make(map[string]string, len(old)+len(values))
+	for k, v := range old {
+		merged[k] = v
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged
+}
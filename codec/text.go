@@ -0,0 +1,132 @@
+package codec
+
+import (
+	"strings"
+	"vdex/parser"
+)
+
+const textHeader = "# This is config file that contains the input values for the REPLACE-ME indicated variables in main.tf" +
+	"\n# Right hand side values can be edited. Please do not edit left hand side names"
+
+/*
+ * TextCodec handles the native vdex format, series of (key = value) pairs, each pair in a new line
+ * Lines starting with terraform comments (# // /*) are ignored
+ */
+type TextCodec struct{}
+
+func (TextCodec) Name() string {
+	return "txt"
+}
+
+func (TextCodec) Extensions() []string {
+	return []string{".txt"}
+}
+
+/*
+ * Splits a config line into the key and the value
+ * Returns false for comments, blank lines and lines without assignment
+ */
+func splitLine(line string) (string, string, bool) {
+	text := strings.TrimSpace(line)
+	if text == "" || strings.HasPrefix(text, parser.COMMENT1) || strings.HasPrefix(text, parser.COMMENT2) || strings.HasPrefix(text, parser.COMMENT3) {
+		return "", "", false
+	}
+	idx := strings.Index(text, "=")
+	if idx < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(text[:idx]), strings.TrimSpace(text[idx+1:]), true
+}
+
+/*
+ * Splits the config line at lines[i] into the key and the value, a value that is not complete
+ * on the line (map, heredoc, multi line list or function call) continues on the next lines
+ * Returns the key, the value, the number of lines of the pair and false if the line is not a pair
+ */
+func splitPair(lines []string, i int) (string, string, int, bool) {
+	k, v, ok := splitLine(lines[i])
+	if !ok {
+		return "", "", 1, false
+	}
+	if v == "" {
+		return k, v, 1, true
+	}
+	// an unquoted setting is not a terraform expression, // and # are part of the value
+	// (eg: template = git::file:///srv/git/templates//modules/x?ref=v1.1.0)
+	if IsSetting(k) && !strings.ContainsAny(v[:1], "\"[{<") {
+		return k, v, 1, true
+	}
+	j := i
+	expr := parser.ScanExpr(v, func() (string, bool) {
+		if j+1 >= len(lines) {
+			return "", false
+		}
+		j++
+		return lines[j], true
+	})
+	return k, expr.Text, expr.Lines + 1, true
+}
+
+func (TextCodec) Decode(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); {
+		k, v, n, ok := splitPair(lines, i)
+		if ok {
+			values[k] = v
+		}
+		i += n
+	}
+	return values, nil
+}
+
+func (TextCodec) Encode(values map[string]string) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteString(textHeader)
+	for _, k := range SortKeys(values) {
+		sb.WriteString("\n" + k + " = " + values[k])
+	}
+	return []byte(sb.String()), nil
+}
+
+/*
+ * Lines of the keys whose value is unchanged, comments and unknown keys are kept as is,
+ * changed values are replaced in place and new keys are appended
+ */
+func (TextCodec) Merge(existing []byte, values map[string]string) ([]byte, error) {
+	var sb strings.Builder
+
+	text := string(existing)
+	trailingNL := strings.HasSuffix(text, "\n")
+	text = strings.TrimSuffix(text, "\n")
+
+	seen := make(map[string]bool)
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		k, v, n, ok := splitPair(lines, i)
+		pair := strings.Join(lines[i:i+n], "\n")
+		if ok {
+			if newValue, found := values[k]; found {
+				seen[k] = true
+				if newValue != v {
+					idx := strings.Index(pair, "=")
+					pair = pair[:idx+1] + " " + newValue
+				}
+			}
+		}
+		sb.WriteString(pair)
+		i += n
+	}
+	for _, k := range SortKeys(values) {
+		if !seen[k] {
+			sb.WriteString("\n" + k + " = " + values[k])
+		}
+	}
+	if trailingNL {
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String()), nil
+}
@@ -0,0 +1,101 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// key of the object that holds a raw terraform expression in the structured formats
+const EXPR_KEY = "expr"
+
+/*
+ * Converts the terraform expression text of a key to a native value of the structured formats
+ * - settings are kept as plain strings
+ * - literals that are valid JSON (strings, numbers, booleans, null, lists) are converted as is
+ * - any other expression (references, maps, function calls) is kept as {"expr": "<text>"}
+ */
+func toNative(key string, value string) interface{} {
+	if IsSetting(key) {
+		return value
+	}
+	if json.Valid([]byte(value)) {
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		var native interface{}
+		if err := dec.Decode(&native); err == nil {
+			return native
+		}
+	}
+	return map[string]interface{}{EXPR_KEY: value}
+}
+
+/*
+ * Converts a native value of the structured formats back to the terraform expression text
+ */
+func fromNative(key string, native interface{}) (string, error) {
+	switch v := native.(type) {
+	case string:
+		if IsSetting(key) {
+			return v, nil
+		}
+		return marshal(v)
+	case json.Number:
+		return v.String(), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "null", nil
+	case map[string]interface{}:
+		if expr, ok := v[EXPR_KEY].(string); ok && len(v) == 1 {
+			return expr, nil
+		}
+		return marshal(v)
+	case []interface{}:
+		return marshal(v)
+	}
+	return "", fmt.Errorf("unsupported value of %s: %v", key, native)
+}
+
+// compact JSON is a valid terraform expression for strings, numbers, lists and objects
+func marshal(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// converts all the values of the config to native values
+func toNativeMap(values map[string]string) map[string]interface{} {
+	natives := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		natives[k] = toNative(k, v)
+	}
+	return natives
+}
+
+// converts all the native values to terraform expression text
+func fromNativeMap(natives map[string]interface{}) (map[string]string, error) {
+	values := make(map[string]string, len(natives))
+	for k, native := range natives {
+		v, err := fromNative(k, native)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = v
+	}
+	return values, nil
+}
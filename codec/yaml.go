@@ -0,0 +1,80 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * YAMLCodec stores the config as a single YAML mapping keyed by the config keys
+ * eg: 'module "echo".foo': 5
+ */
+type YAMLCodec struct{}
+
+func (YAMLCodec) Name() string {
+	return "yaml"
+}
+
+func (YAMLCodec) Extensions() []string {
+	return []string{".yaml", ".yml"}
+}
+
+func (YAMLCodec) Decode(data []byte) (map[string]string, error) {
+	natives := make(map[string]interface{})
+	if len(bytes.TrimSpace(data)) == 0 {
+		return map[string]string{}, nil
+	}
+	if err := yaml.Unmarshal(data, &natives); err != nil {
+		return nil, err
+	}
+	return fromNativeMap(natives)
+}
+
+func (YAMLCodec) Encode(values map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(plainNumbers(toNativeMap(values))); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+ * Keys present only in the existing content are retained
+ */
+func (c YAMLCodec) Merge(existing []byte, values map[string]string) ([]byte, error) {
+	old, err := c.Decode(existing)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encode(mergeValues(old, values))
+}
+
+// yaml encoder quotes json.Number, convert them to int64 or float64
+func plainNumbers(native interface{}) interface{} {
+	switch v := native.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = plainNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = plainNumbers(item)
+		}
+	}
+	return native
+}
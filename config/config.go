@@ -1,9 +1,14 @@
 package config
 
 import (
+	"fmt"
+	"log"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"vdex/codec"
 )
 
 const (
@@ -11,13 +16,62 @@ const (
 	WORKSPACE_DEF = "default"
 )
 
+// Keys of the system config recording the resolved remote template
+const (
+	TEMPLATE_COMMIT_KEY   = "template_commit"
+	TEMPLATE_CHECKSUM_KEY = "template_checksum"
+)
+
+// Key of the system config listing the systems it is planned and applied after (eg: depends_on = ["iam", "network"])
+const DEPENDS_ON_KEY = "depends_on"
+
+// Render modes of the REPLACE-ME values
+const (
+	// values are substituted in the generated terraform files
+	RENDER_INLINE = "inline"
+	// values are referenced as variables and written to <env>.tfvars
+	RENDER_TFVARS = "tfvars"
+)
+
+// Keys of the project config file
+const (
+	RENDER_MODE_KEY = "render_mode"
+	TEMPLATE_KEY    = "template"
+	REGISTRY_KEY    = "registry"
+	BACKEND_KEY     = "backend"
+)
+
+// Prefix of the project config keys passed to terraform init as backend config (eg: backend.key = "{{system}}/{{env}}.tfstate")
+const BACKEND_CONFIG_PREFIX = "backend."
+
+// Placeholders of the backend config values, replaced with the name of the system and the environment
+const (
+	SYSTEM_PLACEHOLDER = "{{system}}"
+	ENV_PLACEHOLDER    = "{{env}}"
+)
+
+var (
+	// placeholder of a backend config value, eg: {{env}}
+	placeholder = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+	// terraform backend type, eg: s3, azurerm
+	backendType = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
 type Config struct {
-	Modfile   string `default:"main.tf"`
-	ConfPath  string `default:"src"`
-	ConfFile  string `default:"config.txt"`
-	CachePath string `default:".cache"`
-	LogFile   string `default:"log.txt"`
-	Tabsize   int    `default:"4"`
+	Modfile     string `default:"main.tf"`
+	ConfPath    string `default:"src"`
+	ConfFile    string `default:"config.txt"`
+	CachePath   string `default:".cache"`
+	LogFile     string `default:"log.txt"`
+	ProjectPath string `default:".vdex"`
+	ProjectFile string `default:"config.txt"`
+	RenderMode  string `default:"inline"`
+	Registry    string
+	// backend type of the generated files (eg: s3), the backend block of the template is used if empty
+	Backend string
+	// backend config by name, the values may have the placeholders {{system}} and {{env}}
+	BackendConfig map[string]string
+	Tabsize       int `default:"4"`
 }
 
 // Returns new Config object
@@ -34,15 +88,16 @@ func (cfg *Config) GetConfFile(myenv string) string {
 	return myenv + "-" + cfg.ConfFile
 }
 
+// Returns the environment of the config file name (eg: dev for dev-config.txt), default for config.txt
 func GetEnvFromConfFile(myconfFile string) string {
-	idx := strings.Index(myconfFile, "-")
-	if idx > 0 && idx < len(myconfFile) {
-		return myconfFile[idx+1:]
+	idx := strings.LastIndex(myconfFile, "-")
+	if idx > 0 {
+		return myconfFile[:idx]
 	}
 	return WORKSPACE_DEF
 }
 
-// Sets the filepath
+// Sets the template - a terraform file, a directory or a glob pattern
 func (cfg *Config) SetFilePath(p string) {
 	cfg.Modfile = p
 }
@@ -52,6 +107,75 @@ func (cfg *Config) SetConfPath(p string) {
 	cfg.ConfPath = p
 }
 
+// Sets the render mode
+func (cfg *Config) SetRenderMode(mode string) error {
+	if mode != RENDER_INLINE && mode != RENDER_TFVARS {
+		return fmt.Errorf("invalid render mode %q, expected %s or %s", mode, RENDER_INLINE, RENDER_TFVARS)
+	}
+	cfg.RenderMode = mode
+	return nil
+}
+
+/*
+ * Loads the optional project config file (.vdex/config.txt) which overrides the defaults
+ * Returns error if the file exists but cannot be read or holds invalid values
+ */
+func (cfg *Config) LoadProject() error {
+	projectFile := codec.Locate(filepath.Join(cfg.ProjectPath, cfg.ProjectFile))
+	if projectFile == "" {
+		return nil
+	}
+	values, err := codec.ReadFile(projectFile)
+	if err != nil {
+		log.Println("Failed to read project config", projectFile, err)
+		return err
+	}
+	for k, v := range values {
+		v = strings.Trim(v, "\"")
+		switch k {
+		case TEMPLATE_KEY:
+			cfg.SetFilePath(v)
+		case REGISTRY_KEY:
+			cfg.Registry = v
+		case RENDER_MODE_KEY:
+			if err := cfg.SetRenderMode(v); err != nil {
+				return fmt.Errorf("%s: %w", projectFile, err)
+			}
+		case BACKEND_KEY:
+			if !backendType.MatchString(v) {
+				return fmt.Errorf("%s: invalid backend %q, expected a terraform backend type (eg: s3)", projectFile, v)
+			}
+			cfg.Backend = v
+		default:
+			name, found := strings.CutPrefix(k, BACKEND_CONFIG_PREFIX)
+			if !found || name == "" {
+				log.Println("Unknown project config key", k, "in", projectFile)
+				continue
+			}
+			for _, p := range placeholder.FindAllString(v, -1) {
+				if p != SYSTEM_PLACEHOLDER && p != ENV_PLACEHOLDER {
+					return fmt.Errorf("%s: %s has unknown placeholder %s, expected %s or %s", projectFile, k, p, SYSTEM_PLACEHOLDER, ENV_PLACEHOLDER)
+				}
+			}
+			if cfg.BackendConfig == nil {
+				cfg.BackendConfig = make(map[string]string)
+			}
+			cfg.BackendConfig[name] = v
+		}
+	}
+	return nil
+}
+
+// Returns the backend config of the system and environment with the placeholders replaced
+func (cfg *Config) BackendSettings(system string, myenv string) map[string]string {
+	r := strings.NewReplacer(SYSTEM_PLACEHOLDER, system, ENV_PLACEHOLDER, myenv)
+	settings := make(map[string]string, len(cfg.BackendConfig))
+	for k, v := range cfg.BackendConfig {
+		settings[k] = r.Replace(v)
+	}
+	return settings
+}
+
 // Sets the tab size
 func (cfg *Config) SetTabSize(s int) {
 	cfg.Tabsize = s
@@ -82,6 +206,15 @@ func setDefaults(p *Config) {
 				if field.Name == "LogFile" && p.LogFile == "" {
 					p.LogFile = value
 				}
+				if field.Name == "ProjectPath" && p.ProjectPath == "" {
+					p.ProjectPath = value
+				}
+				if field.Name == "ProjectFile" && p.ProjectFile == "" {
+					p.ProjectFile = value
+				}
+				if field.Name == "RenderMode" && p.RenderMode == "" {
+					p.RenderMode = value
+				}
 			case reflect.Int:
 				if p.Tabsize == 0 {
 					if intValue, err := strconv.Atoi(value); err == nil {
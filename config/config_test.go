@@ -0,0 +1,23 @@
+package config_test
+
+import (
+	"testing"
+	cfg "vdex/config"
+)
+
+func TestGetEnvFromConfFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"config", cfg.WORKSPACE_DEF},
+		{"dev-config", "dev"},
+		{"eu-west-config", "eu-west"},
+		{"prod-eu-west-1-config", "prod-eu-west-1"},
+	}
+	for _, tt := range tests {
+		if got := cfg.GetEnvFromConfFile(tt.name); got != tt.want {
+			t.Errorf("GetEnvFromConfFile(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package convert
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"vdex/codec"
+	cfg "vdex/config"
+)
+
+/*
+ * Returns the config files of the system folder that are to be converted
+ * all: config files of every environment, otherwise only the one of myenv
+ */
+func configFiles(config *cfg.Config, teamCfgPath string, myenv string, all bool) []string {
+	var files []string
+	if !all {
+		if teamCfgFile := codec.Locate(path.Join(teamCfgPath, config.GetConfFile(myenv))); teamCfgFile != "" {
+			files = append(files, teamCfgFile)
+		}
+		return files
+	}
+
+	entries, err := os.ReadDir(teamCfgPath)
+	if err != nil {
+		log.Println(err)
+		return files
+	}
+	for _, cv := range entries {
+		if !cv.IsDir() && codec.IsConfigFile(cv.Name(), config.ConfFile) {
+			files = append(files, path.Join(teamCfgPath, cv.Name()))
+		}
+	}
+	return files
+}
+
+/*
+ * Converts the config file to the target format, the old file is removed on success
+ * Returns the name of the new file
+ */
+func ConvertFile(teamCfgFile string, target codec.Codec) (string, error) {
+	values, err := codec.ReadFile(teamCfgFile)
+	if err != nil {
+		return "", err
+	}
+
+	newFile := codec.WithExt(teamCfgFile, target)
+	if _, err := os.Stat(newFile); err == nil {
+		return "", fmt.Errorf("%s already exists", newFile)
+	}
+
+	data, err := target.Encode(values)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(newFile, data, 0666); err != nil {
+		log.Println("Failed to write file:", newFile)
+		return "", err
+	}
+	if err := os.Remove(teamCfgFile); err != nil {
+		log.Println("Failed to remove file:", teamCfgFile)
+		return newFile, err
+	}
+	return newFile, nil
+}
+
+/*
+ * Converts the config files of the systems to the target format
+ * system: only the named system is converted if not empty
+ * all: config files of every environment are converted, otherwise only the one of myenv
+ * Returns
+ * list of the converted files
+ * error: if any failure
+ */
+func VdexConvert(config *cfg.Config, myenv string, system string, format string, all bool) ([]string, error) {
+	var converted []string
+
+	log.Printf("\nIn VdexConvert")
+	target, err := codec.ForName(format)
+	if err != nil {
+		return converted, err
+	}
+
+	entries, err := os.ReadDir(config.ConfPath)
+	if err != nil {
+		log.Println(err)
+		return converted, err
+	}
+
+	var failed error
+	for _, v := range entries {
+		if !v.IsDir() || (system != "" && v.Name() != system) {
+			continue
+		}
+		teamCfgPath := path.Join(config.ConfPath, v.Name())
+		for _, teamCfgFile := range configFiles(config, teamCfgPath, myenv, all) {
+			if c, err := codec.ForFile(teamCfgFile); err == nil && c.Name() == target.Name() {
+				continue
+			}
+			newFile, err := ConvertFile(teamCfgFile, target)
+			if err != nil {
+				log.Println("Failed to convert", teamCfgFile, err)
+				fmt.Println("Failed to convert", teamCfgFile, ":", err)
+				failed = err
+				continue
+			}
+			fmt.Println("Converted", teamCfgFile, "to", newFile)
+			converted = append(converted, newFile)
+		}
+	}
+	return converted, failed
+}
@@ -0,0 +1,243 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind of a line in the computed difference
+type Op int
+
+const (
+	EQUAL  Op = 0
+	INSERT Op = 1
+	DELETE Op = 2
+)
+
+// structure to hold a single line of the difference
+type Line struct {
+	// kind of the change
+	Op Op
+	// text of the line without the line break
+	Text string
+	// line number in the old text (0 when inserted)
+	OldLine int
+	// line number in the new text (0 when deleted)
+	NewLine int
+}
+
+/*
+ * Splits the text into lines, a trailing line break does not produce an empty line
+ */
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.TrimSuffix(text, "\n")
+	return strings.Split(text, "\n")
+}
+
+/*
+ * Computes the line based difference of the old and new text
+ * Returns the lines of both texts annotated with the kind of change
+ */
+func Lines(oldText string, newText string) []Line {
+	a := SplitLines(oldText)
+	b := SplitLines(newText)
+
+	// common prefix and suffix do not need the lcs table
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var lines []Line
+	for i := 0; i < pre; i++ {
+		lines = append(lines, Line{Op: EQUAL, Text: a[i], OldLine: i + 1, NewLine: i + 1})
+	}
+
+	ma := a[pre : len(a)-suf]
+	mb := b[pre : len(b)-suf]
+	n, m := len(ma), len(mb)
+
+	// lcs[i][j] holds the length of the longest common subsequence of ma[i:] and mb[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && ma[i] == mb[j]:
+			lines = append(lines, Line{Op: EQUAL, Text: ma[i], OldLine: pre + i + 1, NewLine: pre + j + 1})
+			i++
+			j++
+		case j < m && (i == n || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, Line{Op: INSERT, Text: mb[j], NewLine: pre + j + 1})
+			j++
+		default:
+			lines = append(lines, Line{Op: DELETE, Text: ma[i], OldLine: pre + i + 1})
+			i++
+		}
+	}
+
+	for k := 0; k < suf; k++ {
+		lines = append(lines, Line{Op: EQUAL, Text: a[len(a)-suf+k], OldLine: len(a) - suf + k + 1, NewLine: len(b) - suf + k + 1})
+	}
+	return lines
+}
+
+/*
+ * Returns true if any of the lines is an insert or a delete
+ */
+func Changed(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != EQUAL {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Formats the difference of the old and new text in the unified diff format
+ * context is the number of unchanged lines printed around each change
+ * Returns empty string if both texts are same
+ */
+func Unified(oldName string, newName string, oldText string, newText string, context int) string {
+	lines := Lines(oldText, newText)
+	if !Changed(lines) {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	n := len(lines)
+	for i := 0; i < n; {
+		// find the next change
+		for i < n && lines[i].Op == EQUAL {
+			i++
+		}
+		if i == n {
+			break
+		}
+
+		// extend the hunk while changes are within 2*context lines of each other
+		start := max(i-context, 0)
+		end := i
+		for end < n {
+			if lines[end].Op != EQUAL {
+				end++
+				continue
+			}
+			k := end
+			for k < n && lines[k].Op == EQUAL {
+				k++
+			}
+			if k == n || k-end > 2*context {
+				end = min(end+context, n)
+				break
+			}
+			end = k
+		}
+
+		oldStart, newStart, oldCount, newCount := 0, 0, 0, 0
+		for _, l := range lines[start:end] {
+			if l.Op != INSERT {
+				if oldStart == 0 {
+					oldStart = l.OldLine
+				}
+				oldCount++
+			}
+			if l.Op != DELETE {
+				if newStart == 0 {
+					newStart = l.NewLine
+				}
+				newCount++
+			}
+		}
+		if oldStart == 0 {
+			oldStart = hunkAnchor(lines, start, true)
+		}
+		if newStart == 0 {
+			newStart = hunkAnchor(lines, start, false)
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, l := range lines[start:end] {
+			switch l.Op {
+			case INSERT:
+				sb.WriteString("+" + l.Text + "\n")
+			case DELETE:
+				sb.WriteString("-" + l.Text + "\n")
+			default:
+				sb.WriteString(" " + l.Text + "\n")
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// line number preceding an empty hunk side as per the unified format
+func hunkAnchor(lines []Line, start int, old bool) int {
+	for k := start - 1; k >= 0; k-- {
+		if old && lines[k].OldLine > 0 {
+			return lines[k].OldLine
+		}
+		if !old && lines[k].NewLine > 0 {
+			return lines[k].NewLine
+		}
+	}
+	return 0
+}
+
+// ANSI escape codes used by Colorize
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+/*
+ * Colors the lines of a unified diff for the terminal
+ * file headers are bold, hunk headers cyan, inserts green and deletes red
+ */
+func Colorize(unified string) string {
+	var sb strings.Builder
+	for _, l := range SplitLines(unified) {
+		switch {
+		case strings.HasPrefix(l, "--- "), strings.HasPrefix(l, "+++ "):
+			sb.WriteString(colorBold + l + colorReset)
+		case strings.HasPrefix(l, "@@"):
+			sb.WriteString(colorCyan + l + colorReset)
+		case strings.HasPrefix(l, "+"):
+			sb.WriteString(colorGreen + l + colorReset)
+		case strings.HasPrefix(l, "-"):
+			sb.WriteString(colorRed + l + colorReset)
+		default:
+			sb.WriteString(l)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
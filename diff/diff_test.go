@@ -0,0 +1,61 @@
+package diff_test
+
+import (
+	"testing"
+	"vdex/diff"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		context int
+		want    string
+	}{
+		{"same", "a\nb\n", "a\nb\n", 3, ""},
+		{"both empty", "", "", 3, ""},
+		{"added file", "", "a\nb\n", 3, "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"deleted file", "a\nb\n", "", 3, "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"changed line", "a\nb\nc\n", "a\nx\nc\n", 3, "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"no context", "a\nb\nc\n", "a\nx\nc\n", 0, "--- old\n+++ new\n@@ -2,1 +2,1 @@\n-b\n+x\n"},
+		{"inserted line", "a\nc\n", "a\nb\nc\n", 0, "--- old\n+++ new\n@@ -1,0 +2,1 @@\n+b\n"},
+		{"deleted line", "a\nb\nc\n", "a\nc\n", 0, "--- old\n+++ new\n@@ -2,1 +1,0 @@\n-b\n"},
+		{"trailing line break", "a\nb", "a\nb\n", 3, ""},
+		{
+			"two hunks", "1\n2\n3\n4\n5\n6\n7\n8\n", "x\n2\n3\n4\n5\n6\n7\ny\n", 1,
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -7,2 +7,2 @@\n 7\n-8\n+y\n",
+		},
+		{
+			"close changes share a hunk", "1\n2\n3\n4\n", "x\n2\n3\ny\n", 1,
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n-4\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diff.Unified("old", "new", tt.old, tt.new, tt.context); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		unified string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"file headers", "--- old\n+++ new\n", "\x1b[1m--- old\x1b[0m\n\x1b[1m+++ new\x1b[0m\n"},
+		{"hunk header", "@@ -1,1 +1,1 @@\n", "\x1b[36m@@ -1,1 +1,1 @@\x1b[0m\n"},
+		{"changes", "-a\n+b\n c\n", "\x1b[31m-a\x1b[0m\n\x1b[32m+b\x1b[0m\n c\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diff.Colorize(tt.unified); got != tt.want {
+				t.Errorf("Colorize(%q) = %q, want %q", tt.unified, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// structure holds the dependencies between the nodes (eg: systems)
+type Graph struct {
+	// the nodes each node depends on, by node
+	deps map[string][]string
+}
+
+// error of a dependency cycle, the first node is repeated at the end (eg: app -> network -> app)
+type CycleError struct {
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+/*
+ * Returns an empty graph
+ */
+func New() *Graph {
+	return &Graph{deps: make(map[string][]string)}
+}
+
+/*
+ * Adds the node and the nodes it depends on, a node may be added more than once
+ */
+func (g *Graph) Add(node string, deps ...string) {
+	for _, d := range deps {
+		if !slices.Contains(g.deps[node], d) {
+			g.deps[node] = append(g.deps[node], d)
+		}
+	}
+	if _, found := g.deps[node]; !found {
+		g.deps[node] = nil
+	}
+}
+
+/*
+ * Returns the nodes in the order of the names
+ */
+func (g *Graph) Nodes() []string {
+	nodes := make([]string, 0, len(g.deps))
+	for n := range g.deps {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+/*
+ * Returns the nodes the node depends on in the order of the names
+ */
+func (g *Graph) Deps(node string) []string {
+	deps := append([]string{}, g.deps[node]...)
+	sort.Strings(deps)
+	return deps
+}
+
+/*
+ * Checks that every dependency is a node of the graph
+ */
+func (g *Graph) check() error {
+	for _, n := range g.Nodes() {
+		for _, d := range g.Deps(n) {
+			if _, found := g.deps[d]; !found {
+				return fmt.Errorf("%s depends on %s which is not found", n, d)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * Returns the nodes ordered so that each node comes after the nodes it depends on,
+ * nodes that do not depend on each other are in the order of the names
+ * Returns a *CycleError if the dependencies have a cycle
+ */
+func (g *Graph) Order() ([]string, error) {
+	if err := g.check(); err != nil {
+		return nil, err
+	}
+	pending := make(map[string]int, len(g.deps))
+	for n, deps := range g.deps {
+		pending[n] = len(deps)
+	}
+
+	var order []string
+	for len(order) < len(g.deps) {
+		var ready []string
+		for n, count := range pending {
+			if count == 0 {
+				ready = append(ready, n)
+			}
+		}
+		if len(ready) == 0 {
+			return nil, &CycleError{Cycle: g.cycle(pending)}
+		}
+		sort.Strings(ready)
+		// one node at a time keeps the order of the names among the ready nodes
+		n := ready[0]
+		delete(pending, n)
+		order = append(order, n)
+		for m := range pending {
+			if slices.Contains(g.deps[m], n) {
+				pending[m]--
+			}
+		}
+	}
+	return order, nil
+}
+
+// returns a cycle among the pending nodes, each of them waits for another pending node
+func (g *Graph) cycle(pending map[string]int) []string {
+	var nodes []string
+	for n := range pending {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+
+	// follow the first pending dependency until a node repeats
+	seen := make(map[string]int)
+	var path []string
+	n := nodes[0]
+	for {
+		if i, found := seen[n]; found {
+			return append(path[i:], n)
+		}
+		seen[n] = len(path)
+		path = append(path, n)
+		for _, d := range g.Deps(n) {
+			if _, waiting := pending[d]; waiting {
+				n = d
+				break
+			}
+		}
+	}
+}
+
+/*
+ * Returns the graph of the nodes, a node keeps the nodes it depends on through the nodes that are left out
+ */
+func (g *Graph) Subgraph(nodes []string) *Graph {
+	keep := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		keep[n] = true
+	}
+	sub := New()
+	for _, n := range nodes {
+		if _, found := g.deps[n]; !found {
+			continue
+		}
+		sub.Add(n)
+		seen := make(map[string]bool)
+		var walk func(string)
+		walk = func(m string) {
+			for _, d := range g.deps[m] {
+				if seen[d] {
+					continue
+				}
+				seen[d] = true
+				if keep[d] {
+					sub.Add(n, d)
+				} else {
+					walk(d)
+				}
+			}
+		}
+		walk(n)
+	}
+	return sub
+}
+
+/*
+ * Returns the graph with the dependencies reversed, a node depends on the nodes that depended on it
+ */
+func (g *Graph) Reverse() *Graph {
+	rev := New()
+	for _, n := range g.Nodes() {
+		rev.Add(n)
+		for _, d := range g.Deps(n) {
+			rev.Add(d, n)
+		}
+	}
+	return rev
+}
+
+/*
+ * Visits the nodes in the dependency order, at most parallel nodes at the same time
+ * a node is visited once the nodes it depends on are visited successfully, visit returns false on failure
+ * skip is called instead of visit for a node whose dependency failed or was skipped
+ * Returns the nodes in the dependency order, or a *CycleError if the dependencies have a cycle
+ */
+func (g *Graph) Walk(parallel int, visit func(node string) bool, skip func(node string, dep string)) ([]string, error) {
+	order, err := g.Order()
+	if err != nil {
+		return nil, err
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	const (
+		pending = iota
+		running
+		succeeded
+		failed
+	)
+	type done struct {
+		node string
+		ok   bool
+	}
+	state := make(map[string]int, len(order))
+	results := make(chan done)
+	active, finished := 0, 0
+	for finished < len(order) {
+		for _, n := range order {
+			if state[n] != pending {
+				continue
+			}
+			ready, blocker := true, ""
+			for _, d := range g.Deps(n) {
+				switch state[d] {
+				case failed:
+					blocker = d
+				case pending, running:
+					ready = false
+				}
+				if blocker != "" {
+					break
+				}
+			}
+			// the dependencies come first in the order, a skip is seen by the nodes after it
+			if blocker != "" {
+				state[n] = failed
+				finished++
+				skip(n, blocker)
+			} else if ready && active < parallel {
+				state[n] = running
+				active++
+				go func(n string) {
+					results <- done{n, visit(n)}
+				}(n)
+			}
+		}
+		if active == 0 {
+			continue
+		}
+		r := <-results
+		active--
+		finished++
+		state[r.node] = failed
+		if r.ok {
+			state[r.node] = succeeded
+		}
+	}
+	return order, nil
+}
+
+/*
+ * Writes the graph in the DOT language of graphviz, the edges go from a node to the nodes depending on it
+ */
+func (g *Graph) WriteDot(w io.Writer, name string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %q {\n  rankdir=LR;\n", name)
+	for _, n := range g.Nodes() {
+		fmt.Fprintf(&sb, "  %q;\n", n)
+	}
+	for _, n := range g.Nodes() {
+		for _, d := range g.Deps(n) {
+			fmt.Fprintf(&sb, "  %q -> %q;\n", d, n)
+		}
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+/*
+ * Writes the graph as a Mermaid flowchart, the edges go from a node to the nodes depending on it
+ */
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("graph LR\n")
+	ids := make(map[string]string)
+	for i, n := range g.Nodes() {
+		// names may have characters mermaid does not take in an id (eg: -)
+		ids[n] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&sb, "  %s[\"%s\"]\n", ids[n], strings.ReplaceAll(n, "\"", "#quot;"))
+	}
+	for _, n := range g.Nodes() {
+		for _, d := range g.Deps(n) {
+			fmt.Fprintf(&sb, "  %s --> %s\n", ids[d], ids[n])
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,143 @@
+package graph_test
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"vdex/graph"
+)
+
+// builds a graph from edges like "app:network,iam", a node without ":" has no dependencies
+func build(edges ...string) *graph.Graph {
+	g := graph.New()
+	for _, e := range edges {
+		node, deps, found := strings.Cut(e, ":")
+		if !found || deps == "" {
+			g.Add(node)
+			continue
+		}
+		g.Add(node, strings.Split(deps, ",")...)
+	}
+	return g
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges []string
+		want  []string
+		cycle string
+		err   bool
+	}{
+		{"empty", nil, nil, "", false},
+		{"names", []string{"b", "a", "c"}, []string{"a", "b", "c"}, "", false},
+		{"chain", []string{"a:b", "b:c", "c"}, []string{"c", "b", "a"}, "", false},
+		{"diamond", []string{"app:iam,network", "network:iam", "iam", "web"}, []string{"iam", "network", "app", "web"}, "", false},
+		{"self", []string{"a:a"}, nil, "a -> a", false},
+		{"cycle", []string{"a:b", "b:c", "c:a", "d"}, nil, "a -> b -> c -> a", false},
+		{"missing dependency", []string{"a:b"}, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := build(tt.edges...).Order()
+			var cycle *graph.CycleError
+			switch {
+			case tt.cycle != "":
+				if !errors.As(err, &cycle) || strings.Join(cycle.Cycle, " -> ") != tt.cycle {
+					t.Fatalf("Order() error = %v, want cycle %s", err, tt.cycle)
+				}
+			case tt.err:
+				if err == nil || errors.As(err, &cycle) {
+					t.Fatalf("Order() error = %v, want a missing dependency", err)
+				}
+			case err != nil:
+				t.Fatalf("Order() error = %v", err)
+			case !slices.Equal(got, tt.want):
+				t.Errorf("Order() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubgraph(t *testing.T) {
+	// app depends on iam through network which is left out
+	g := build("app:network", "network:iam", "iam", "web").Subgraph([]string{"app", "iam"})
+	if got := g.Nodes(); !slices.Equal(got, []string{"app", "iam"}) {
+		t.Errorf("Nodes() = %v", got)
+	}
+	if got := g.Deps("app"); !slices.Equal(got, []string{"iam"}) {
+		t.Errorf("Deps(app) = %v, want [iam]", got)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	order, err := build("app:network", "network:iam", "iam").Reverse().Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"app", "network", "iam"}; !slices.Equal(order, want) {
+		t.Errorf("Order() = %v, want %v", order, want)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		name     string
+		edges    []string
+		fail     []string
+		visited  []string
+		skipped  []string
+		parallel int
+	}{
+		{"all succeed", []string{"app:network", "network:iam", "iam", "web"}, nil, []string{"app", "iam", "network", "web"}, nil, 4},
+		{"failure skips the dependents", []string{"app:network", "network:iam", "iam", "web"}, []string{"iam"}, []string{"iam", "web"}, []string{"app<-network", "network<-iam"}, 4},
+		{"failure of a leaf", []string{"app:network", "network", "web:network"}, []string{"app"}, []string{"app", "network", "web"}, nil, 1},
+		{"skip through a diamond", []string{"app:iam,network", "network:iam", "iam"}, []string{"network"}, []string{"iam", "network"}, []string{"app<-network"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var visited, skipped []string
+			done := make(map[string]bool)
+			g := build(tt.edges...)
+			_, err := g.Walk(tt.parallel, func(node string) bool {
+				mu.Lock()
+				defer mu.Unlock()
+				for _, d := range g.Deps(node) {
+					if !done[d] {
+						t.Errorf("%s is visited before %s", node, d)
+					}
+				}
+				done[node] = true
+				visited = append(visited, node)
+				return !slices.Contains(tt.fail, node)
+			}, func(node string, dep string) {
+				mu.Lock()
+				defer mu.Unlock()
+				skipped = append(skipped, node+"<-"+dep)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(visited)
+			sort.Strings(skipped)
+			if !slices.Equal(visited, tt.visited) {
+				t.Errorf("visited %v, want %v", visited, tt.visited)
+			}
+			if !slices.Equal(skipped, tt.skipped) {
+				t.Errorf("skipped %v, want %v", skipped, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestWalkCycle(t *testing.T) {
+	_, err := build("a:b", "b:a").Walk(1, func(string) bool { return true }, func(string, string) {})
+	var cycle *graph.CycleError
+	if !errors.As(err, &cycle) {
+		t.Errorf("Walk() error = %v, want a cycle", err)
+	}
+}
@@ -0,0 +1,249 @@
+package history
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	cfg "vdex/config"
+)
+
+// folder of the project holding the history, one JSON lines file per system and environment
+const HISTORY_PATH = "history"
+
+// number of resources changed by a plan or an apply
+type Counts struct {
+	Add     int `json:"add" yaml:"add"`
+	Change  int `json:"change" yaml:"change"`
+	Destroy int `json:"destroy" yaml:"destroy"`
+}
+
+// structure holds a run of plan or apply, entries are only appended
+type Entry struct {
+	// start time of the run
+	Time time.Time `json:"time" yaml:"time"`
+	// terraform command (plan or apply)
+	Command string `json:"command" yaml:"command"`
+	// user and host running vdex
+	User string `json:"user" yaml:"user"`
+	Host string `json:"host" yaml:"host"`
+	// git commit of the project, empty if it is not a git repository
+	Commit string `json:"commit,omitempty" yaml:"commit,omitempty"`
+	// true if the project has uncommitted changes
+	Dirty bool `json:"dirty,omitempty" yaml:"dirty,omitempty"`
+	// name of the system
+	System string `json:"system" yaml:"system"`
+	// environment of the config and the terraform workspace
+	Environment string `json:"environment" yaml:"environment"`
+	Workspace   string `json:"workspace" yaml:"workspace"`
+	// config file and the checksum of its content
+	ConfigFile string `json:"config_file" yaml:"config_file"`
+	ConfigHash string `json:"config_hash" yaml:"config_hash"`
+	// template and the checksum of its files
+	Template     string `json:"template" yaml:"template"`
+	TemplateHash string `json:"template_hash" yaml:"template_hash"`
+	// success or failed
+	Status string `json:"status" yaml:"status"`
+	// resources changed by the run, nil if terraform did not report them
+	Resources *Counts `json:"resources,omitempty" yaml:"resources,omitempty"`
+	// error messages of terraform
+	Errors []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+	// duration of the run in seconds
+	Duration float64 `json:"duration_seconds" yaml:"duration_seconds"`
+	// snapshot taken after a successful apply
+	Snapshot string `json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+}
+
+// structure holds the conditions of a query, empty fields match all the entries
+type Filter struct {
+	System      string
+	Environment string
+	// entries older than Since are skipped
+	Since time.Time
+}
+
+/*
+ * Returns the history file of the system and environment (eg: .vdex/history/sys1/dev.jsonl)
+ */
+func File(config *cfg.Config, system string, myenv string) string {
+	return filepath.Join(config.ProjectPath, HISTORY_PATH, system, myenv+".jsonl")
+}
+
+/*
+ * Appends the entry to the history of its system and environment
+ */
+func Append(config *cfg.Config, entry Entry) error {
+	file := File(config, entry.System, entry.Environment)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	// a single write keeps the line whole when runs append at the same time
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+/*
+ * Returns the entries matching the filter, oldest first
+ */
+func Query(config *cfg.Config, filter Filter) ([]Entry, error) {
+	entries := []Entry{}
+	root := filepath.Join(config.ProjectPath, HISTORY_PATH)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".jsonl" {
+			return nil
+		}
+		system := filepath.Base(filepath.Dir(p))
+		env := strings.TrimSuffix(d.Name(), ".jsonl")
+		if (filter.System != "" && system != filter.System) || (filter.Environment != "" && env != filter.Environment) {
+			return nil
+		}
+		found, err := readFile(p)
+		if err != nil {
+			return err
+		}
+		for _, e := range found {
+			if e.Time.Before(filter.Since) {
+				continue
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
+
+// reads the entries of the history file, lines that can not be decoded are skipped
+func readFile(name string) ([]Entry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			log.Printf("Skipping the line %d of %s: %v", n, name, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+/*
+ * Parses the start of a query, either a duration before now (eg: 12h, 7d)
+ * or a date (eg: 2024-05-01, 2024-05-01T10:00:00Z)
+ */
+func ParseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if days, found := strings.CutSuffix(since, "d"); found {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", since, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q, use a duration (eg: 12h, 7d) or a date (eg: 2024-05-01)", since)
+}
+
+/*
+ * Returns the name of the user running vdex
+ */
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	for _, v := range []string{"USER", "USERNAME"} {
+		if name := os.Getenv(v); name != "" {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+/*
+ * Returns the name of the host running vdex
+ */
+func Hostname() string {
+	if h, err := os.Hostname(); err == nil {
+		return h
+	}
+	return "unknown"
+}
+
+/*
+ * Returns the git commit of the current folder and whether it has uncommitted changes
+ * the changes of the folder exclude (eg: .vdex, it holds the history) are ignored
+ * the commit is empty if the folder is not in a git repository
+ */
+func GitCommit(exclude string) (string, bool) {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", false
+	}
+	status, err := exec.Command("git", "status", "--porcelain", "--", ".", ":(exclude)"+filepath.ToSlash(exclude)).Output()
+	return strings.TrimSpace(string(out)), err == nil && len(strings.TrimSpace(string(status))) > 0
+}
+
+/*
+ * Returns the checksum of the content of the file
+ */
+func FileHash(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
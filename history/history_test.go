@@ -0,0 +1,42 @@
+package history_test
+
+import (
+	"testing"
+	"time"
+	"vdex/history"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		since string
+		want  time.Time
+		err   bool
+	}{
+		{"", time.Time{}, false},
+		{"7d", now.AddDate(0, 0, -7), false},
+		{"0d", now, false},
+		{"12h", now.Add(-12 * time.Hour), false},
+		{"90m", now.Add(-90 * time.Minute), false},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local), false},
+		{"2024-05-01T10:00:00Z", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), false},
+		{"-1d", time.Time{}, true},
+		{"d", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+		{"2024-13-01", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.since, func(t *testing.T) {
+			got, err := history.ParseSince(tt.since, now)
+			if tt.err {
+				if err == nil {
+					t.Errorf("ParseSince(%q) = %v, want an error", tt.since, got)
+				}
+				return
+			}
+			if err != nil || !got.Equal(tt.want) {
+				t.Errorf("ParseSince(%q) = %v, %v, want %v", tt.since, got, err, tt.want)
+			}
+		})
+	}
+}
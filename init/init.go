@@ -1,37 +1,74 @@
 package init
 
 import (
+	"fmt"
 	"log"
-	"os"
+	"path/filepath"
+	"vdex/codec"
 	cfg "vdex/config"
 	parcer "vdex/parser"
+	"vdex/template"
 )
 
+/*
+ * Returns the template source for init
+ * the template passed by the user, else the template of the existing system, else the project template
+ */
+func initSource(config *cfg.Config, myenv string, system string, templateSrc string) string {
+	if templateSrc != "" {
+		return templateSrc
+	}
+	if system == "" {
+		return config.Modfile
+	}
+	teamCfgPath := filepath.Join(config.ConfPath, system)
+	values := make(map[string]string)
+	if teamCfgFile := codec.Locate(filepath.Join(teamCfgPath, config.GetConfFile(myenv))); teamCfgFile != "" {
+		if stored, err := codec.ReadFile(teamCfgFile); err == nil {
+			values = stored
+		}
+	}
+	return template.SystemSource(config, teamCfgPath, values)
+}
+
 /*
  * Prompts the user for the configuration data and saves it in the target location
+ * system: optional name of the system, its existing config and template are used
+ * templateSrc: optional template, it is recorded in the config of the system
  * Returns
  * string: file location where the config is saved
- * error: if any failure
+ * error: if any failure, ErrNotSaved if the existing config is left unchanged
  */
-func VdexInit(config *cfg.Config, myenv string) (string, error) {
+func VdexInit(config *cfg.Config, myenv string, system string, templateSrc string) (string, error) {
 
 	log.Printf("\nIn VdexInit")
-	file, err := os.Open(config.Modfile)
+	source := initSource(config, myenv, system, templateSrc)
+	tmpl, err := template.Load(config, source)
 	if err != nil {
-		log.Println("Failed to open file:", config.Modfile)
+		log.Println("Failed to load the template:", source)
 		return "", err
 	}
-	defer file.Close()
 
 	//log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
 
-	parcedBlocks, err := parcer.ParseTF(config.Modfile, nil, nil)
+	parcedBlocks, err := tmpl.Parse()
 	if err != nil {
-		log.Println("Failed to parse file:", config.Modfile)
+		log.Println("Failed to parse the template:", source)
 		return "", err
 	}
+	for _, w := range template.ReferenceWarnings(parcedBlocks, nil) {
+		fmt.Printf("warning: %s: default of %s\n", source, w)
+	}
+
+	// record the resolved remote template in the config
+	if tmpl.Remote != nil {
+		if tmpl.Remote.Commit != "" {
+			parcedBlocks.Param[cfg.TEMPLATE_COMMIT_KEY] = parcer.ParamValue{P_value: tmpl.Remote.Commit}
+		}
+		parcedBlocks.Param[cfg.TEMPLATE_CHECKSUM_KEY] = parcer.ParamValue{P_value: tmpl.Remote.Checksum}
+	}
 
 	//tfbs.Walk(0, config.Tabsize, outlog)
-	return PromptConfig(parcedBlocks, config.ConfPath, myenv, config.GetConfFile(myenv))
+	return PromptConfig(parcedBlocks, config.ConfPath, myenv, config.GetConfFile(myenv), system, templateSrc)
 
 }
@@ -0,0 +1,170 @@
+package init
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"vdex/codec"
+	cfg "vdex/config"
+	"vdex/diff"
+	"vdex/parser"
+	"vdex/template"
+)
+
+/*
+ * Returns the config file of the target environment in the format of the source config
+ * the existing config file of the target is kept in its format
+ */
+func promoteTarget(config *cfg.Config, teamCfgPath string, srcFile string, toEnv string) string {
+	if target := codec.Locate(filepath.Join(teamCfgPath, config.GetConfFile(toEnv))); target != "" {
+		return target
+	}
+	target := filepath.Join(teamCfgPath, config.GetConfFile(toEnv))
+	if c, err := codec.ForFile(srcFile); err == nil {
+		target = codec.WithExt(target, c)
+	}
+	return target
+}
+
+/*
+ * Copies the config of the system from the source environment into the target environment
+ * - the values marked with the REPLACE-ME env comment in the template are prompted for,
+ *   the value of the existing target config is the default, else the value of the source
+ * - environment is set to the target environment
+ * - the difference with the existing target config is shown for confirmation
+ * Returns
+ * string: the written config file, empty if the config is not changed or not confirmed
+ * error: if any failure
+ */
+func PromoteSystem(config *cfg.Config, teamCfgPath string, srcFile string, fromEnv string, toEnv string, reader *bufio.Reader) (string, error) {
+	values, err := codec.ReadFile(srcFile)
+	if err != nil {
+		return "", err
+	}
+	source := template.SystemSource(config, teamCfgPath, values)
+	tmpl, err := template.Load(config, source)
+	if err != nil {
+		log.Println("Failed to load the template:", source)
+		return "", err
+	}
+	parcedBlocks, err := tmpl.Parse()
+	if err != nil {
+		log.Println("Failed to parse the template:", source)
+		return "", err
+	}
+
+	target := promoteTarget(config, teamCfgPath, srcFile, toEnv)
+	existing, err := os.ReadFile(target)
+	stored := make(map[string]string)
+	if err == nil {
+		if stored, err = codec.ReadFile(target); err != nil {
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	fmt.Printf("\nPromoting %s to %s\n", srcFile, target)
+	promoted := make(map[string]string, len(values))
+	for k, v := range values {
+		promoted[k] = v
+	}
+	envKeys := 0
+	for _, k := range codec.SortKeys(parcedBlocks.Schema) {
+		if !parcedBlocks.Schema[k].P_env {
+			continue
+		}
+		envKeys++
+		def, found := stored[k]
+		if !found {
+			def = values[k]
+		}
+		fmt.Printf("\n%s (%s=%s)[default=%s]:", k, fromEnv, values[k], def)
+		if mvalue, _ := readLine(reader); mvalue != "" {
+			def = mvalue
+		}
+		if def != "" {
+			promoted[k] = def
+		}
+	}
+	if envKeys == 0 {
+		fmt.Printf("\nNo value of the template is marked with // %s, all the values are copied\n", parser.REPLACE_ENV)
+	}
+	promoted[cfg.WORKSPACE_KEY] = toEnv
+
+	data, err := codec.Format(target, promoted)
+	if err != nil {
+		log.Println("Failed to format config:", err)
+		return "", err
+	}
+	if existing != nil {
+		changes := diff.Unified(target, target, string(existing), string(data), 3)
+		if changes == "" {
+			fmt.Printf("\n%s is up to date\n", target)
+			return "", nil
+		}
+		fmt.Printf("\n%s", changes)
+		if !Confirm(reader, "\nOverwrite "+target+"?") {
+			fmt.Println("Config is not saved")
+			return "", nil
+		}
+	}
+	return target, writeConfig(filepath.Dir(target), filepath.Base(target), data)
+}
+
+/*
+ * Promotes the config files of the source environment to the target environment, see PromoteSystem
+ * system: only the named system is promoted if not empty
+ * Returns
+ * list of the written config files
+ * error: if any failure
+ */
+func VdexPromote(config *cfg.Config, fromEnv string, toEnv string, system string) ([]string, error) {
+	var promoted []string
+
+	log.Printf("\nIn VdexPromote")
+	if fromEnv == toEnv {
+		return promoted, fmt.Errorf("source and target environments are the same: %s", fromEnv)
+	}
+	entries, err := os.ReadDir(config.ConfPath)
+	if err != nil {
+		log.Println(err)
+		return promoted, err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	found := false
+	var failed error
+	for _, v := range entries {
+		if !v.IsDir() || (system != "" && v.Name() != system) {
+			continue
+		}
+		teamCfgPath := filepath.Join(config.ConfPath, v.Name())
+		srcFile := codec.Locate(filepath.Join(teamCfgPath, config.GetConfFile(fromEnv)))
+		if srcFile == "" {
+			continue
+		}
+		found = true
+		target, err := PromoteSystem(config, teamCfgPath, srcFile, fromEnv, toEnv, reader)
+		if err != nil {
+			log.Println("Failed to promote", srcFile, err)
+			fmt.Println("Failed to promote", srcFile, ":", err)
+			failed = err
+			continue
+		}
+		if target != "" {
+			fmt.Println("Promoted", srcFile, "to", target)
+			promoted = append(promoted, target)
+		}
+	}
+	if !found {
+		where := "any system"
+		if system != "" {
+			where = "system " + system
+		}
+		return promoted, fmt.Errorf("no config of environment %s in %s", fromEnv, where)
+	}
+	return promoted, failed
+}
@@ -2,22 +2,49 @@ package init
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"vdex/codec"
 	cfg "vdex/config"
+	"vdex/diff"
 	"vdex/parser"
+	"vdex/template"
 )
 
+// error of a config that is not saved, the existing config has no changes or the user declined to overwrite it
+var ErrNotSaved = errors.New("config is not saved")
+
+/*
+ * Returns the values of the params as config key = value pairs
+ */
+func configValues(parcedBlocks *parser.TFBlocks) map[string]string {
+	values := make(map[string]string, len(parcedBlocks.Param))
+	for k, v := range parcedBlocks.Param {
+		values[k] = v.P_value
+	}
+	return values
+}
+
 /*
  * Writes the configuration data to the target location confPath + confFileName
+ * The format is selected by the extension of confFileName, an existing file is updated in place
  * Returns
  * error: if any failure
  */
 func SaveConfig(parcedBlocks *parser.TFBlocks, confPath string, confFileName string) error {
+	data, err := codec.Format(filepath.Join(confPath, confFileName), configValues(parcedBlocks))
+	if err != nil {
+		log.Println("Failed to format config:", err)
+		return err
+	}
+	return writeConfig(confPath, confFileName, data)
+}
 
+func writeConfig(confPath string, confFileName string, data []byte) error {
 	if _, err := os.Stat(confPath); os.IsNotExist(err) { // Create Path if not present
 		err = os.Mkdir(confPath, 0755) //create a directory
 		if err != nil {
@@ -35,24 +62,52 @@ func SaveConfig(parcedBlocks *parser.TFBlocks, confPath string, confFileName str
 	}
 	defer file.Close()
 
-	file.WriteString("# This is config file that contains the input values for the REPLACE-ME indicated variables in main.tf")
-	file.WriteString("\n# Right hand side values can be edited. Please do not edit left hand side names")
-	for k, v := range parcedBlocks.Param {
-		//fmt.Printf("\n%s=>%s", k, v.P_value)
-		file.WriteString("\n" + k + " = " + v.P_value)
+	_, err = file.Write(data)
+	return err
+}
+
+// Reads a line from the user, the line break is removed
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+/*
+ * Asks the user to confirm the action
+ * Returns true only if the user answers yes
+ */
+func Confirm(reader *bufio.Reader, question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := readLine(reader)
+	if err != nil {
+		return false
 	}
-	return nil
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes"
 }
 
 /*
  * Prompts the user for the configuration data and saves
+ * If the config of the system already exists, stored values are offered as the defaults
+ * and the difference is shown for confirmation before the file is overwritten
+ * system: optional system name, used as the default of the system name
+ * templateSrc: optional template, recorded in the config relative to the system folder
  * Returns
  * string: file location where the config is saved
- * error: if any failure
+ * error: if any failure, ErrNotSaved if the existing config is left unchanged
  */
-func PromptConfig(parcedBlocks *parser.TFBlocks, confPath string, myenv string, confFile string) (string, error) {
-	var mvalue, sysName string
-	n := len(parcedBlocks.Param)
+func PromptConfig(parcedBlocks *parser.TFBlocks, confPath string, myenv string, confFile string, system string, templateSrc string) (string, error) {
+	sysName := system
+	var stored map[string]string
+	n := 0
+	for k := range parcedBlocks.Param {
+		if !codec.IsSetting(k) {
+			n++
+		}
+	}
 	reader := bufio.NewReader(os.Stdin)
 
 	if n == 0 {
@@ -64,6 +119,40 @@ func PromptConfig(parcedBlocks *parser.TFBlocks, confPath string, myenv string,
 		fmt.Printf("\n!!To leave the default value unchanged, just Hit ENTER!!\n")
 	}
 
+	// the config file name asked for, confFile follows the format of the stored config
+	requestedFile := confFile
+	loadStored := func(sysName string) {
+		// forget the config of a system loaded before, it must not be offered for this one
+		stored = nil
+		confFile = requestedFile
+		storedFile := codec.Locate(filepath.Join(confPath, strings.ReplaceAll(sysName, "\"", ""), confFile))
+		if storedFile == "" {
+			return
+		}
+		var err error
+		stored, err = codec.ReadFile(storedFile)
+		if err != nil {
+			log.Println("Failed to load the existing config", storedFile, err)
+		} else {
+			// keep updating the existing file in its format
+			confFile = filepath.Base(storedFile)
+			fmt.Printf("\nFound existing config %s, stored values are shown as defaults\n", storedFile)
+		}
+	}
+
+	keys := codec.SortKeys(parcedBlocks.Param)
+	if len(keys) == 0 || !strings.HasSuffix(keys[0], codec.SYSTEM_KEY_SUFFIX) {
+		// no system name in the template, config lives in confPath/system
+		loadStored(sysName)
+	} else if sysName != "" {
+		loadStored(sysName)
+		if _, ok := stored[keys[0]]; !ok {
+			v := parcedBlocks.Param[keys[0]]
+			v.P_value = "\"" + sysName + "\""
+			parcedBlocks.Param[keys[0]] = v
+		}
+	}
+
 	var userConfig map[string]string = make(map[string]string)
 
 	wsParam := parser.ParamValue{}
@@ -71,50 +160,55 @@ func PromptConfig(parcedBlocks *parser.TFBlocks, confPath string, myenv string,
 	wsParam.P_type = parser.V_STRING
 	wsParam.P_value = myenv
 
-	for k, v := range parcedBlocks.Param {
-		var err error
-		n = 0
+	for _, k := range keys {
+		if codec.IsSetting(k) {
+			continue
+		}
+		v := parcedBlocks.Param[k]
+		if storedValue, ok := stored[k]; ok {
+			v.P_value = storedValue
+			parcedBlocks.Param[k] = v
+		}
+
+		var mvalue string
 		maxAttempt := 3
 		attempt := 0
 
 		fmt.Printf("\n%s[default=%s]:", k, v.P_value)
 		for attempt < maxAttempt {
-			if v.P_type == parser.V_MAP_OR_SET || v.P_type == parser.V_LIST || v.P_type == parser.V_SCALAR {
-				mvalue, err = reader.ReadString('\n')
-				if err == nil && strings.TrimSpace(mvalue) != "" {
-					n = 1
-				}
-			} else {
-				n, err = fmt.Scanln(&mvalue)
-				if err != nil {
-				}
-			}
+			mvalue, _ = readLine(reader)
 			attempt++
-			if n <= 0 && attempt < maxAttempt && v.P_value == parser.REPLACE2 {
+			if mvalue == "" && attempt < maxAttempt && v.P_value == parser.REPLACE2 {
 				fmt.Printf("\n this param has no default value, input again attempt %d of %d:", attempt+1, maxAttempt)
 			} else {
 				break
 			}
 		}
-		if n > 0 {
-			userConfig[k] = strings.TrimSpace(mvalue)
-			//v.P_value = strings.TrimSpace(mvalue)
-			//parcedBlocks.Param[k] = v
+		if mvalue != "" {
+			userConfig[k] = mvalue
 		}
-		if strings.HasSuffix(k, "tags.\"System-Name\"") {
-			if n > 0 {
-				sysName = strings.TrimSpace(mvalue)
+		if strings.HasSuffix(k, codec.SYSTEM_KEY_SUFFIX) {
+			if mvalue != "" {
+				sysName = mvalue
 			} else {
 				sysName = v.P_value
 			}
+			if system == "" || mvalue != "" {
+				loadStored(sysName)
+			}
+			if storedTemplate := stored[cfg.TEMPLATE_KEY]; storedTemplate != "" && system == "" && templateSrc == "" {
+				fmt.Printf("\nwarning: the system uses the template %s, run init with --system %s to prompt for its values\n", storedTemplate, strings.ReplaceAll(sysName, "\"", ""))
+			}
 		}
 	}
 
 	// Read workspace
+	if storedValue, ok := stored[cfg.WORKSPACE_KEY]; ok && storedValue != "" {
+		wsParam.P_value = storedValue
+	}
 	fmt.Printf("\n%s(workspace)[default=%s]:", cfg.WORKSPACE_KEY, wsParam.P_value)
-	n, _ = fmt.Scanln(&mvalue)
-	if n > 0 {
-		wsParam.P_value = strings.TrimSpace(mvalue)
+	if mvalue, _ := readLine(reader); mvalue != "" {
+		wsParam.P_value = mvalue
 	}
 	parcedBlocks.Param[cfg.WORKSPACE_KEY] = wsParam
 
@@ -127,6 +221,12 @@ func PromptConfig(parcedBlocks *parser.TFBlocks, confPath string, myenv string,
 	path := filepath.Join(confPath, strings.ReplaceAll(sysName, "\"", ""))
 	confFFile := filepath.Join(path, confFile)
 
+	if templateSrc != "" {
+		tmplParam := parser.ParamValue{}
+		tmplParam.P_value = template.RelativeSource(path, templateSrc)
+		parcedBlocks.Param[cfg.TEMPLATE_KEY] = tmplParam
+	}
+
 	// Create confPath if not available
 	if _, err := os.Stat(confPath); os.IsNotExist(err) { // Create Path if not present
 		err = os.Mkdir(confPath, 0755) //create a directory
@@ -135,6 +235,24 @@ func PromptConfig(parcedBlocks *parser.TFBlocks, confPath string, myenv string,
 		}
 	}
 
-	return confFFile, SaveConfig(parcedBlocks, path, confFile)
+	existing, err := os.ReadFile(confFFile)
+	if err != nil {
+		// new config file
+		return confFFile, SaveConfig(parcedBlocks, path, confFile)
+	}
 
+	data, err := codec.Format(confFFile, configValues(parcedBlocks))
+	if err != nil {
+		log.Println("Failed to format config:", err)
+		return confFFile, err
+	}
+	changes := diff.Unified(confFFile, confFFile, string(existing), string(data), 3)
+	if changes == "" {
+		return confFFile, fmt.Errorf("%w, no changes to the existing config %s", ErrNotSaved, confFFile)
+	}
+	fmt.Printf("\n\n%s\n", changes)
+	if !Confirm(reader, "Overwrite "+confFFile+"?") {
+		return confFFile, fmt.Errorf("%w, the existing config %s is left unchanged", ErrNotSaved, confFFile)
+	}
+	return confFFile, writeConfig(path, confFile, data)
 }
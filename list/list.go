@@ -2,45 +2,58 @@ package list
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path"
-	"strings"
+	"vdex/codec"
 	cfg "vdex/config"
+	"vdex/output"
 	plan "vdex/plan"
+	"vdex/template"
 )
 
-// Prints list of workspaces present
-func ListWorkSpaces() {
-	app := "terraform"
-	cmdoutput, err := exec.Command(app, "workspace", "list").Output()
-	if err == nil {
-		fmt.Println(cmdoutput)
-	}
+// structure holds a system as listed
+type SystemInfo struct {
+	// name of the system
+	Name string `json:"name" yaml:"name"`
+	// folder the terraform files are generated in
+	CachePath string `json:"cache_path" yaml:"cache_path"`
+	// config files of the system
+	Configs []ConfigInfo `json:"configs" yaml:"configs"`
+}
+
+// structure holds a config file of a system as listed
+type ConfigInfo struct {
+	// path of the config file
+	File string `json:"file" yaml:"file"`
+	// environment (workspace) set in the config file
+	Environment string `json:"environment" yaml:"environment"`
+	// template of the system
+	Template string `json:"template" yaml:"template"`
+	// result of the last plan or apply, nil if never run
+	LastRun *plan.RunResult `json:"last_run,omitempty" yaml:"last_run,omitempty"`
 }
 
-// Prints list of systems present
-func ListSystems(config *cfg.Config, myenv string) {
-	//var fileList []string
+/*
+ * Returns the systems and their config files, myenv filters the config files if it is not default
+ */
+func Systems(config *cfg.Config, myenv string) ([]SystemInfo, error) {
+	systems := []SystemInfo{}
 	confPath := config.ConfPath
 	entries, err := os.ReadDir(confPath)
-
 	if err != nil {
 		log.Println(err)
-		return
+		return nil, err
 	}
 
-	fmt.Printf("%-15s %-20s %-15s\n", "system-name", "conf-file", "environment")
-	fmt.Printf("--------------- -------------------- ---------------\n")
 	// loop over all system-names
 	for _, v := range entries {
 		if !v.IsDir() {
 			continue
 		}
-
-		fmt.Printf("%-15s", v.Name())
 		teamCfgPath := path.Join(confPath, v.Name())
+		system := SystemInfo{Name: v.Name(), CachePath: path.Join(teamCfgPath, config.CachePath), Configs: []ConfigInfo{}}
 
 		cfgentries, err := os.ReadDir(teamCfgPath)
 		if err != nil {
@@ -48,28 +61,68 @@ func ListSystems(config *cfg.Config, myenv string) {
 		}
 
 		// loop over all config files
-		firstLine := true
 		for _, cv := range cfgentries {
-			if !strings.HasSuffix(cv.Name(), config.ConfFile) {
+			if !codec.IsConfigFile(cv.Name(), config.ConfFile) {
 				continue
-			} else if myenv != cfg.WORKSPACE_DEF && cv.Name() != config.GetConfFile(myenv) {
+			} else if myenv != cfg.WORKSPACE_DEF && codec.Base(cv.Name()) != codec.Base(config.GetConfFile(myenv)) {
 				continue
 			}
 
 			teamCfgFile := path.Join(teamCfgPath, cv.Name())
+			log.Printf("File %s exists\n", teamCfgFile)
+			userConfig, err := codec.ReadFile(teamCfgFile)
+			if err != nil {
+				log.Println("Failed to read config file:", teamCfgFile, err)
+			}
+
+			info := ConfigInfo{
+				File:        teamCfgFile,
+				Environment: plan.GetConfigWorkspace(teamCfgFile),
+				Template:    template.SystemSource(config, teamCfgPath, userConfig),
+			}
+			env := cfg.GetEnvFromConfFile(codec.Base(cv.Name()))
+			if info.LastRun, err = plan.ReadStatus(config, v.Name(), env); err != nil {
+				log.Println("Failed to read the status of", v.Name(), env, err)
+			}
+			system.Configs = append(system.Configs, info)
+		}
+		systems = append(systems, system)
+	}
+	return systems, nil
+}
 
-			if _, err := os.Stat(teamCfgFile); err == nil {
-				log.Printf("File %s exists\n", teamCfgFile)
+/*
+ * Prints list of systems present in the format (table, json or yaml)
+ */
+func ListSystems(config *cfg.Config, myenv string, format string, w io.Writer) error {
+	systems, err := Systems(config, myenv)
+	if err != nil {
+		return err
+	}
+	if format != output.FORMAT_TABLE {
+		return output.Write(w, format, systems)
+	}
 
-				reqWorkspace := plan.GetConfigWorkspace(teamCfgFile)
-				if firstLine {
-					fmt.Printf(" %-20s %-15s\n", cv.Name(), reqWorkspace)
-				} else {
-					fmt.Printf("%-15s %-20s %-15s\n", "", cv.Name(), reqWorkspace)
-				}
-				firstLine = false
+	table := output.NewTable("system-name", "conf-file", "environment", "template", "last-run")
+	for _, s := range systems {
+		if len(s.Configs) == 0 {
+			table.Add(s.Name)
+		}
+		for i, c := range s.Configs {
+			name := s.Name
+			if i > 0 {
+				name = ""
 			}
+			table.Add(name, path.Base(c.File), c.Environment, c.Template, lastRun(c.LastRun))
 		}
+	}
+	return table.Write(w)
+}
 
+// formats the last run for the table (eg: apply success 2024-05-01 10:30)
+func lastRun(r *plan.RunResult) string {
+	if r == nil {
+		return "-"
 	}
+	return fmt.Sprintf("%s %s %s", r.Command, r.Status, r.Started.Local().Format("2006-01-02 15:04"))
 }
@@ -0,0 +1,252 @@
+package list
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"vdex/codec"
+	cfg "vdex/config"
+	"vdex/output"
+	plan "vdex/plan"
+)
+
+// structure holds the terraform workspaces of a system
+type SystemWorkspaces struct {
+	// name of the system
+	System string `json:"system" yaml:"system"`
+	// folder terraform runs in
+	CachePath string `json:"cache_path" yaml:"cache_path"`
+	// workspaces of the system, empty if terraform was not initialized
+	Workspaces []WorkspaceInfo `json:"workspaces" yaml:"workspaces"`
+	// environments having a config file, by their workspace
+	Environments map[string]string `json:"environments" yaml:"environments"`
+	// error of terraform listing the workspaces
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// structure holds a terraform workspace of a system
+type WorkspaceInfo struct {
+	// name of the workspace
+	Name string `json:"name" yaml:"name"`
+	// true if the workspace is selected
+	Current bool `json:"current" yaml:"current"`
+	// environment of the config file using the workspace, empty if no config file uses it
+	Environment string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	// number of resources in the state, nil if terraform could not list the state
+	Resources *int `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+/*
+ * Returns the environments of the config files of the system by their workspace
+ * a config file uses the workspace set by its environment setting and the one named after its environment
+ */
+func configEnvironments(system SystemInfo) map[string]string {
+	envs := make(map[string]string)
+	for _, c := range system.Configs {
+		env := cfg.GetEnvFromConfFile(codec.Base(path.Base(c.File)))
+		envs[c.Environment] = env
+		if _, found := envs[env]; !found {
+			envs[env] = env
+		}
+	}
+	return envs
+}
+
+/*
+ * Returns the terraform workspaces of the systems with the environments having a config file
+ * system: returns only the named system if set
+ * myenv: the workspaces of the backend of the environment if set, terraform is initialized again if the
+ * backend config of the project differs per environment, otherwise the backend the system was last initialized with
+ */
+func Workspaces(config *cfg.Config, system string, myenv string) ([]SystemWorkspaces, error) {
+	systems, err := Systems(config, cfg.WORKSPACE_DEF)
+	if err != nil {
+		return nil, err
+	}
+	found := []SystemWorkspaces{}
+	for _, s := range systems {
+		if system != "" && s.Name != system {
+			continue
+		}
+		sw := SystemWorkspaces{System: s.Name, CachePath: s.CachePath, Workspaces: []WorkspaceInfo{}, Environments: configEnvironments(s)}
+		if myenv != "" {
+			if err := plan.SelectBackend(config, s.CachePath, s.Name, myenv); err != nil {
+				log.Println("Failed to select the backend of", s.Name, myenv, err)
+				sw.Error = err.Error()
+				found = append(found, sw)
+				continue
+			}
+		}
+		tf := plan.NewTerraform(s.CachePath)
+		names, current, err := tf.Workspaces()
+		if err != nil {
+			log.Println("Failed to list the workspaces of", s.Name, err)
+			sw.Error = err.Error()
+		}
+		for _, name := range names {
+			ws := WorkspaceInfo{Name: name, Current: name == current, Environment: sw.Environments[name]}
+			if n, err := tf.StateCount(name); err != nil {
+				log.Println("Failed to list the state of", s.Name, name, err)
+			} else {
+				ws.Resources = &n
+			}
+			sw.Workspaces = append(sw.Workspaces, ws)
+		}
+		found = append(found, sw)
+	}
+	if system != "" && len(found) == 0 {
+		return nil, fmt.Errorf("system %s not found in %s", system, config.ConfPath)
+	}
+	return found, nil
+}
+
+/*
+ * Prints the workspaces of the systems in the format (table, json or yaml)
+ * environments having a config file without a workspace are listed with the workspace -
+ */
+func ListWorkSpaces(config *cfg.Config, system string, myenv string, format string, w io.Writer) error {
+	systems, err := Workspaces(config, system, myenv)
+	if err != nil {
+		return err
+	}
+	if format != output.FORMAT_TABLE {
+		return output.Write(w, format, systems)
+	}
+
+	table := output.NewTable("system-name", "workspace", "current", "environment", "resources")
+	for _, s := range systems {
+		name := s.System
+		add := func(cols ...string) {
+			table.Add(append([]string{name}, cols...)...)
+			name = ""
+		}
+		if s.Error != "" && len(s.Workspaces) == 0 {
+			add("not initialized", "", "-", "-")
+		}
+		used := make(map[string]bool)
+		for _, ws := range s.Workspaces {
+			current, env, resources := "", "-", "-"
+			if ws.Current {
+				current = "*"
+			}
+			if ws.Environment != "" {
+				env = ws.Environment
+				used[ws.Environment] = true
+			}
+			if ws.Resources != nil {
+				resources = strconv.Itoa(*ws.Resources)
+			}
+			add(ws.Name, current, env, resources)
+		}
+		for _, k := range codec.SortKeys(s.Environments) {
+			if env := s.Environments[k]; k == env && !used[env] {
+				add("-", "", env, "-")
+				used[env] = true
+			}
+		}
+	}
+	return table.Write(w)
+}
+
+/*
+ * Deletes the workspace of the systems having it after confirmation, default workspace is never deleted
+ * terraform refuses to delete a workspace that has resources in its state
+ * system: deletes only in the named system if set
+ * Returns the systems the workspace is deleted from
+ */
+func DeleteWorkspace(config *cfg.Config, system string, myenv string, name string, confirm func(string) bool, out io.Writer) ([]string, error) {
+	if name == cfg.WORKSPACE_DEF {
+		return nil, fmt.Errorf("%s workspace can not be deleted", cfg.WORKSPACE_DEF)
+	}
+	systems, err := Workspaces(config, system, myenv)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	found := false
+	for _, s := range systems {
+		for _, ws := range s.Workspaces {
+			if ws.Name != name {
+				continue
+			}
+			found = true
+			question := fmt.Sprintf("Delete workspace %s of %s?", name, s.System)
+			if ws.Environment != "" {
+				question = fmt.Sprintf("Workspace %s of %s is used by the config of environment %s, delete it?", name, s.System, ws.Environment)
+			}
+			if !confirm(question) {
+				continue
+			}
+			if err := deleteWorkspace(s, ws); err != nil {
+				return deleted, err
+			}
+			fmt.Fprintln(out, "Deleted workspace", name, "of", s.System)
+			deleted = append(deleted, s.System)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("workspace %s not found", name)
+	}
+	return deleted, nil
+}
+
+/*
+ * Deletes the workspaces without resources in their state and without a config file of their environment
+ * after confirmation, default workspace is never deleted
+ * system: prunes only the named system if set
+ * Returns the deleted workspaces as system/workspace
+ */
+func PruneWorkspaces(config *cfg.Config, system string, myenv string, confirm func(string) bool, out io.Writer) ([]string, error) {
+	systems, err := Workspaces(config, system, myenv)
+	if err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		system SystemWorkspaces
+		ws     WorkspaceInfo
+	}
+	var candidates []candidate
+	for _, s := range systems {
+		for _, ws := range s.Workspaces {
+			if ws.Name == cfg.WORKSPACE_DEF || ws.Environment != "" || ws.Resources == nil || *ws.Resources > 0 {
+				continue
+			}
+			candidates = append(candidates, candidate{s, ws})
+		}
+	}
+	if len(candidates) == 0 {
+		fmt.Fprintln(out, "No workspace to prune")
+		return nil, nil
+	}
+
+	fmt.Fprintln(out, "Workspaces with empty state and no config file:")
+	for _, c := range candidates {
+		fmt.Fprintf(out, "  %s/%s\n", c.system.System, c.ws.Name)
+	}
+	if !confirm(fmt.Sprintf("Delete %d workspaces?", len(candidates))) {
+		return nil, nil
+	}
+	var deleted []string
+	for _, c := range candidates {
+		if err := deleteWorkspace(c.system, c.ws); err != nil {
+			return deleted, err
+		}
+		fmt.Fprintln(out, "Deleted workspace", c.ws.Name, "of", c.system.System)
+		deleted = append(deleted, c.system.System+"/"+c.ws.Name)
+	}
+	return deleted, nil
+}
+
+// deletes the workspace of the system, the default workspace is selected first if the workspace is selected
+func deleteWorkspace(s SystemWorkspaces, ws WorkspaceInfo) error {
+	tf := plan.NewTerraform(s.CachePath)
+	if ws.Current {
+		if _, err := tf.Run("workspace", "select", cfg.WORKSPACE_DEF); err != nil {
+			return err
+		}
+	}
+	_, err := tf.Run("workspace", "delete", ws.Name)
+	return err
+}
@@ -0,0 +1,164 @@
+package lock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	cfg "vdex/config"
+	"vdex/history"
+)
+
+// folder of the project holding the locks, one file per system
+const LOCK_PATH = "locks"
+
+// structure holds the run holding the lock of a system
+// a system is locked whatever the environment of the run, all the environments share its .cache folder
+type Lock struct {
+	// name of the system
+	System string `json:"system" yaml:"system"`
+	// environment of the run, empty if the command has none (eg: workspace prune)
+	Environment string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	// vdex command holding the lock (eg: apply)
+	Command string `json:"command" yaml:"command"`
+	// user, host and process id of the vdex process
+	User string `json:"user" yaml:"user"`
+	Host string `json:"host" yaml:"host"`
+	PID  int    `json:"pid" yaml:"pid"`
+	// time the lock was taken
+	Time time.Time `json:"time" yaml:"time"`
+	// lock file
+	File string `json:"-" yaml:"-"`
+}
+
+// error of a system locked by another run
+type LockedError struct {
+	Lock *Lock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, run vdex unlock %s if that run is no longer running", e.Lock, e.Lock.System)
+}
+
+// describes the run holding the lock, eg: sys1 is locked by apply (dev) of alice@host1 (pid 4242) since 2024-05-02 10:15:02
+func (l *Lock) String() string {
+	command := l.Command
+	if l.Environment != "" {
+		command += " (" + l.Environment + ")"
+	}
+	return fmt.Sprintf("%s is locked by %s of %s@%s (pid %d) since %s",
+		l.System, command, l.User, l.Host, l.PID, l.Time.Local().Format(time.DateTime))
+}
+
+/*
+ * Returns the lock file of the system (eg: .vdex/locks/sys1.lock)
+ */
+func File(config *cfg.Config, system string) string {
+	return filepath.Join(config.ProjectPath, LOCK_PATH, system+".lock")
+}
+
+/*
+ * Takes the lock of the system for the command run on the environment
+ * the lock file is written to a temporary file and linked to the lock file only if it does not exist,
+ * so one vdex process holds the lock at a time and the lock file is never read half written
+ * Returns a *LockedError if another run holds the lock
+ */
+func Acquire(config *cfg.Config, system string, myenv string, command string) (*Lock, error) {
+	l := &Lock{
+		System:      system,
+		Environment: myenv,
+		Command:     command,
+		User:        history.CurrentUser(),
+		Host:        history.Hostname(),
+		PID:         os.Getpid(),
+		Time:        time.Now().UTC(),
+		File:        File(config, system),
+	}
+	if err := os.MkdirAll(filepath.Dir(l.File), 0755); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := writeTemp(filepath.Dir(l.File), system, append(data, '\n'))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	err = os.Link(tmp, l.File)
+	if os.IsExist(err) {
+		held, rerr := Read(config, system)
+		if rerr != nil {
+			return nil, fmt.Errorf("%s is locked, %s can not be read: %w", system, l.File, rerr)
+		}
+		return nil, &LockedError{Lock: held}
+	} else if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// writes the data to a new temporary file of the folder, returns the name of the file
+func writeTemp(dir string, system string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, "."+system+".lock-")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+/*
+ * Releases the lock, the lock file is removed only if it still belongs to the lock
+ */
+func (l *Lock) Release() error {
+	held, err := readFile(l.File)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// vdex unlock may have given the lock to another run
+	if held.PID != l.PID || held.Host != l.Host || !held.Time.Equal(l.Time) {
+		return nil
+	}
+	return os.Remove(l.File)
+}
+
+/*
+ * Returns the lock of the system, os.ErrNotExist if it is not locked
+ */
+func Read(config *cfg.Config, system string) (*Lock, error) {
+	return readFile(File(config, system))
+}
+
+/*
+ * Removes the lock of the system whatever run holds it, for the locks of the runs that were killed
+ */
+func Remove(config *cfg.Config, system string) error {
+	return os.Remove(File(config, system))
+}
+
+// reads the lock file
+func readFile(name string) (*Lock, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	l := &Lock{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	l.File = name
+	return l, nil
+}
@@ -0,0 +1,128 @@
+package lock_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	cfg "vdex/config"
+	"vdex/lock"
+)
+
+func TestAcquireRelease(t *testing.T) {
+	config := &cfg.Config{ProjectPath: t.TempDir()}
+
+	held, err := lock.Acquire(config, "sys1", "dev", "apply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lock.File(config, "sys1")); err != nil {
+		t.Fatalf("lock file is not written: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		system string
+		env    string
+		locked bool
+	}{
+		{"same system and environment", "sys1", "dev", true},
+		{"other environment of the system", "sys1", "prod", true},
+		{"other system", "sys2", "dev", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := lock.Acquire(config, tt.system, tt.env, "plan")
+			var locked *lock.LockedError
+			if tt.locked {
+				if !errors.As(err, &locked) {
+					t.Fatalf("Acquire() error = %v, want *LockedError", err)
+				}
+				if locked.Lock.Command != "apply" || locked.Lock.Environment != "dev" || locked.Lock.PID != os.Getpid() {
+					t.Errorf("LockedError holds %+v", locked.Lock)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := l.Release(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	if err := held.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.Read(config, "sys1"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Read() after Release error = %v, want os.ErrNotExist", err)
+	}
+	// releasing twice is not an error
+	if err := held.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleaseAfterUnlock(t *testing.T) {
+	config := &cfg.Config{ProjectPath: t.TempDir()}
+
+	first, err := lock.Acquire(config, "sys1", "dev", "apply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// vdex unlock removes the lock of the first run and another run takes it
+	if err := lock.Remove(config, "sys1"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := lock.Acquire(config, "sys1", "prod", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Release(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := lock.Read(config, "sys1")
+	if err != nil || l.Environment != "prod" {
+		t.Fatalf("the lock of the second run is removed: %v, %v", l, err)
+	}
+	if err := second.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireConcurrent(t *testing.T) {
+	config := &cfg.Config{ProjectPath: t.TempDir()}
+
+	const runs = 20
+	var wg sync.WaitGroup
+	errs := make([]error, runs)
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = lock.Acquire(config, "sys1", "dev", "plan")
+		}()
+	}
+	wg.Wait()
+
+	acquired := 0
+	for _, err := range errs {
+		var locked *lock.LockedError
+		switch {
+		case err == nil:
+			acquired++
+		case !errors.As(err, &locked):
+			// the lock file is read while it is written
+			t.Errorf("Acquire() error = %v, want *LockedError", err)
+		}
+	}
+	if acquired != 1 {
+		t.Errorf("%d runs took the lock, want 1", acquired)
+	}
+	// the temporary files are removed
+	if entries, _ := os.ReadDir(filepath.Dir(lock.File(config, "sys1"))); len(entries) != 1 {
+		t.Errorf("lock folder holds %d files, want 1", len(entries))
+	}
+}
@@ -1,16 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 	cfg "vdex/config"
+	vconvert "vdex/convert"
+	vhistory "vdex/history"
 	vinit "vdex/init"
 	vlist "vdex/list"
+	"vdex/output"
+	vparser "vdex/parser"
 	vplan "vdex/plan"
+	vsnapshot "vdex/snapshot"
+	vtemplate "vdex/template"
 )
 
 // Prints the Help text
@@ -23,11 +34,13 @@ func printHelp(pgname string) {
 		}
 	}
 	fmt.Println("Usage:")
-	fmt.Println(pgname, "init | plan [-s] | apply [-s] | list")
+	fmt.Println(pgname, "init | plan [-s] | apply [-s] | destroy [-s] | graph | render | diff | validate | history | rollback | promote | workspace | output | unlock | list | config convert | template new")
 	fmt.Println("    init [envName] - Takes user input for REPLACE-ME values found in main.tf and stores the config in")
 	fmt.Println("                     sys/<SYSTEM-NAME>/, <SYSTEM-NAME> is one of the user input")
 	fmt.Println("                   - envName is optional argument and if passed, it is treated as the environment which creates")
 	fmt.Println("                     a distrinct config file for the environment. It generated the file <envName>-config.txt")
+	fmt.Println("                   - --template path uses the template for the system and records it in the config")
+	fmt.Println("                   - --system name uses the existing config and template of the system")
 	fmt.Println("")
 	fmt.Println("    plan [-s] [envName] - Generates the main.tf (in sys/<SYSTEM-NAME>/.cache) by replacing the")
 	fmt.Println("                     variable values with the user provided values and executes terraform init & plan")
@@ -36,61 +49,301 @@ func printHelp(pgname string) {
 	fmt.Println("                     process the config file named <envName>-config.txt. The Workspace named <envName> gets created")
 	fmt.Println("                     during terraform init and terraform plan.")
 	fmt.Println("")
+	fmt.Println("                   - --mode tfvars renders the REPLACE-ME values as variables, the values are written")
+	fmt.Println("                     to <envName>.tfvars and passed to terraform with -var-file")
+	fmt.Println("")
 	fmt.Println("    apply [-s] [envName]- similar plan but terraform apply is executed instead of terraform plan")
 	fmt.Println("                     otherwise, rest of the behaviour is same as plan.")
 	fmt.Println("")
+	fmt.Println("                   - the systems run after the systems they depend on, the systems that do not depend on")
+	fmt.Println("                     each other run at the same time, a system is skipped if a system it depends on failed")
+	fmt.Println("")
+	fmt.Println("    destroy [-s] [envName] - similar apply but terraform destroy is executed after confirmation, a system")
+	fmt.Println("                     is destroyed before the systems it depends on")
+	fmt.Println("")
+	fmt.Println("    graph [--env envName] [--format dot|mermaid]")
+	fmt.Println("                   - Prints the dependencies of the systems set by depends_on and by the references to")
+	fmt.Println("                     the outputs of other systems as graphviz DOT (default) or Mermaid flowchart")
+	fmt.Println("")
+	fmt.Println("    render [--system name] [--env envName] [--out dir] [--stdout] [--mode inline|tfvars]")
+	fmt.Println("                   - Generates the terraform files like plan but terraform is not executed")
+	fmt.Println("                   - --system renders only the named system, --out renders into <dir>/<SYSTEM-NAME>/")
+	fmt.Println("                     instead of sys/<SYSTEM-NAME>/.cache, --stdout prints the generated files")
+	fmt.Println("                   - exits with status 1 if a system fails to render")
+	fmt.Println("")
+	fmt.Println("    diff [--system name] [--env envName] [--against gitRef] [--color] [--json]")
+	fmt.Println("                   - Renders the config and shows the changes to the generated files of")
+	fmt.Println("                     sys/<SYSTEM-NAME>/.cache as unified diff, --against compares with the")
+	fmt.Println("                     config at the git ref (eg: HEAD~1), --json prints the list of changes")
+	fmt.Println("")
+	fmt.Println("    validate [--system name] [--env envName] [--skip-terraform]")
+	fmt.Println("                   - Checks the config against the REPLACE-ME values of the template, renders the systems")
+	fmt.Println("                     and runs terraform init -backend=false & terraform validate, the backend is not accessed")
+	fmt.Println("                   - exits with status 1 if any error is found")
+	fmt.Println("")
+	fmt.Println("    history [--system name] [--env envName] [--since 7d|2024-05-01]")
+	fmt.Println("                   - Lists the recorded runs of plan and apply with the user, git commit, status and")
+	fmt.Println("                     resource changes, all the environments are listed unless one is named")
+	fmt.Println("")
+	fmt.Println("    rollback <SYSTEM-NAME> [--env envName] [--to id|previous] [--list]")
+	fmt.Println("                   - Restores the config of the system from the snapshot taken by an apply, shows the")
+	fmt.Println("                     changes and runs terraform plan & apply after confirmation")
+	fmt.Println("                   - --to selects the snapshot (default previous), --list lists the snapshots")
+	fmt.Println("")
+	fmt.Println("    promote <fromEnv> <toEnv> [--system name]")
+	fmt.Println("                   - Copies the config of the source environment into <toEnv>-config.txt, only the values")
+	fmt.Println("                     marked with // REPLACE-ME env in the template are prompted and environment is set to <toEnv>")
+	fmt.Println("                   - the changes to an existing config of the target are shown for confirmation")
+	fmt.Println("")
+	fmt.Println("    workspace list|delete|prune [name] [--system name] [--env envName]")
+	fmt.Println("                   - list shows the terraform workspaces of each system with the environments having a")
+	fmt.Println("                     config file and the number of resources in the state")
+	fmt.Println("                   - delete <name> deletes the workspace after confirmation, prune deletes the workspaces")
+	fmt.Println("                     with empty state and no config file after confirmation, default is never deleted")
+	fmt.Println("                   - --env works on the backend of the environment when the backend config differs per environment")
+	fmt.Println("")
+	fmt.Println("    output [--system name] [--env envName] [--json] [--write]")
+	fmt.Println("                   - Collects the outputs of terraform output -json of each system with the workspace of")
+	fmt.Println("                     the environment, --json prints them as one document by system and environment")
+	fmt.Println("                   - --write saves the outputs of each system in sys/<SYSTEM-NAME>/<envName>-outputs.json,")
+	fmt.Println("                     the values of the sensitive outputs are not saved")
+	fmt.Println("")
+	fmt.Println("    unlock <SYSTEM-NAME>")
+	fmt.Println("                   - Removes the lock of the system after confirmation, plan, apply, destroy, render, validate,")
+	fmt.Println("                     rollback, output and workspace delete|prune lock the systems they run on, a run that is")
+	fmt.Println("                     killed leaves its lock")
+	fmt.Println("")
 	fmt.Println("    list [envName] - Lists out the user configured system-names and the environments")
 	fmt.Println("                   - envName is optional argument and if passed, filter gets applied on the environments")
 	fmt.Println("")
+	fmt.Println("    config convert [--to txt|json|yaml] [--system name] [--all] [envName]")
+	fmt.Println("                   - Converts the config files to the given format, the format of a config file")
+	fmt.Println("                     is selected by its extension (.txt, .json, .yaml/.yml)")
+	fmt.Println("                   - --system converts only the named system, --all converts config files of all environments")
+	fmt.Println("")
+	fmt.Println("    template new --from-module dir [--name name] [--out file] [--all] [--force]")
+	fmt.Println("                   - Generates a starter template calling the module with every input of its variable blocks")
+	fmt.Println("                     inputs without default are REPLACE-ME values, --all marks the optional inputs too")
+	fmt.Println("")
+	fmt.Println("    --output table|json|yaml")
+	fmt.Println("                   - format of the output of list, plan, apply, destroy, validate, history, rollback, workspace list and output, the messages are written")
+	fmt.Println("                     to the standard error with json and yaml")
+	fmt.Println("")
 	fmt.Println("    help           - this usage text")
 }
 
+/*
+ * Parses the flags and the positional arguments of the command, flags may follow the arguments
+ * Returns the positional arguments
+ */
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Prints the errors of the terraform files compiler style
+func printDiagnostics(err error) {
+	var diags vparser.Diagnostics
+	if errors.As(err, &diags) {
+		fmt.Println(diags.Error())
+	}
+}
+
+// Prints the failure of the plan generation, the errors of the terraform files are printed compiler style
+func printGenerationFailure(w io.Writer, err error, logFile string) {
+	var diags vparser.Diagnostics
+	if errors.As(err, &diags) {
+		fmt.Println(diags.Error())
+		fmt.Fprintf(w, "\nplan generation failed, see logs %s\n", logFile)
+	} else {
+		fmt.Fprintf(w, "\nplan generation failed: %v, see logs %s\n", err, logFile)
+	}
+}
+
+// Prints the results of plan or apply in the output format, the table is printed only if there are results
+func printResults(format string, results []vplan.RunResult) {
+	if format == output.FORMAT_TABLE && len(results) == 0 {
+		return
+	}
+	if format == output.FORMAT_TABLE {
+		fmt.Println()
+	}
+	if err := vplan.WriteResults(os.Stdout, format, results); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
 func main() {
 
 	// default values
 	print_help := false
 	apply_tf_init := true
-	cmd_start_idx := 1
 	user_cmd := ""
 	user_env := cfg.WORKSPACE_DEF
-	total_args := len(os.Args[1:])
+	args := os.Args[1:]
 
 	pgname := path.Base(os.Args[0])
 
-	if total_args == 0 || total_args > 3 {
+	if len(args) == 0 {
 		print_help = true
-	} else if os.Args[1] == "-help" || os.Args[1] == "--help" || os.Args[1] == "?" || os.Args[1] == "help" {
+	} else if args[0] == "-help" || args[0] == "--help" || args[0] == "?" || args[0] == "help" {
 		print_help = true
 	}
 
-	if total_args == 2 || total_args == 3 {
-		if strings.TrimSpace(os.Args[2]) == "-s" {
-			apply_tf_init = false
-			cmd_start_idx = 1
-			if total_args > 2 {
-				user_env = os.Args[3]
-			}
-		} else if strings.TrimSpace(os.Args[1]) == "-s" {
-			apply_tf_init = false
-			cmd_start_idx = 2
-			if total_args > 2 {
-				user_env = os.Args[3]
-			}
-		} else {
-			cmd_start_idx = 1
-			user_env = os.Args[2]
-		}
+	if print_help {
+		printHelp(pgname)
+		return
+	}
+
+	// -s is accepted before the command as well
+	if strings.TrimSpace(args[0]) == "-s" {
+		apply_tf_init = false
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		printHelp(pgname)
+		return
+	}
+	user_cmd = args[0]
+
+	fs := flag.NewFlagSet(user_cmd, flag.ContinueOnError)
+	fs.Usage = func() {}
+	skip_tf_init := fs.Bool("s", false, "skip terraform init")
+	output_fmt := fs.String("output", output.FORMAT_TABLE, "output format: table, json or yaml")
 
+	// command specific flags
+	var conv_to, conv_system *string
+	var conv_all *bool
+	var render_mode *string
+	var init_system, init_template *string
+	var tmpl_module, tmpl_name, tmpl_out *string
+	var tmpl_all, tmpl_force *bool
+	var render_system, render_env, render_out *string
+	var render_stdout *bool
+	var diff_against *string
+	var diff_color, diff_json *bool
+	var skip_terraform *bool
+	var hist_since *string
+	var rollback_to *string
+	var rollback_list *bool
+	var out_json, out_write *bool
+	var graph_format *string
+	switch user_cmd {
+	case "template":
+		tmpl_module = fs.String("from-module", "", "module folder")
+		tmpl_name = fs.String("name", "", "name of the module block")
+		tmpl_out = fs.String("out", "main.tf", "generated template file, - for stdout")
+		tmpl_all = fs.Bool("all", false, "optional inputs are REPLACE-ME values too")
+		tmpl_force = fs.Bool("force", false, "overwrite the existing file")
+	case "init":
+		init_system = fs.String("system", "", "system name")
+		init_template = fs.String("template", "", "template of the system")
+	case "plan", "apply", "destroy":
+		render_mode = fs.String("mode", "", "render mode: inline or tfvars")
+	case "graph":
+		render_env = fs.String("env", "", "environment")
+		graph_format = fs.String("format", vplan.GRAPH_DOT, "graph format: dot or mermaid")
+	case "render":
+		render_mode = fs.String("mode", "", "render mode: inline or tfvars")
+		render_system = fs.String("system", "", "system name")
+		render_env = fs.String("env", "", "environment")
+		render_out = fs.String("out", "", "output folder")
+		render_stdout = fs.Bool("stdout", false, "print the generated files")
+	case "diff":
+		render_mode = fs.String("mode", "", "render mode: inline or tfvars")
+		render_system = fs.String("system", "", "system name")
+		render_env = fs.String("env", "", "environment")
+		diff_against = fs.String("against", "", "git ref of the config to compare with")
+		diff_color = fs.Bool("color", false, "color the diff")
+		diff_json = fs.Bool("json", false, "print the changes as json")
+	case "validate":
+		render_mode = fs.String("mode", "", "render mode: inline or tfvars")
+		render_system = fs.String("system", "", "system name")
+		render_env = fs.String("env", "", "environment")
+		skip_terraform = fs.Bool("skip-terraform", false, "check and render the config only")
+	case "history":
+		render_system = fs.String("system", "", "system name")
+		render_env = fs.String("env", "", "environment")
+		hist_since = fs.String("since", "", "duration (eg: 7d) or date (eg: 2024-05-01)")
+	case "output":
+		render_system = fs.String("system", "", "system name")
+		render_env = fs.String("env", "", "environment")
+		out_json = fs.Bool("json", false, "print the outputs as json")
+		out_write = fs.Bool("write", false, "save the outputs of each system")
+	case "workspace":
+		render_system = fs.String("system", "", "system name")
+		render_env = fs.String("env", "", "environment of the backend")
+	case "promote":
+		render_system = fs.String("system", "", "system name")
+	case "rollback":
+		render_env = fs.String("env", "", "environment")
+		rollback_to = fs.String("to", vsnapshot.ID_PREVIOUS, "id of the snapshot, latest or previous")
+		rollback_list = fs.Bool("list", false, "list the snapshots")
+	case "config":
+		conv_to = fs.String("to", "txt", "target config format: txt, json or yaml")
+		conv_system = fs.String("system", "", "system name")
+		conv_all = fs.Bool("all", false, "all environments")
 	}
 
-	if print_help {
+	positional, err := parseArgs(fs, args[1:])
+	if err != nil {
 		printHelp(pgname)
 		return
 	}
+	if *skip_tf_init {
+		apply_tf_init = false
+	}
+	if out_json != nil && *out_json {
+		*output_fmt = output.FORMAT_JSON
+	}
+	if err := output.CheckFormat(*output_fmt); err != nil {
+		fmt.Println(err)
+		return
+	}
+	// messages go to the standard error when the standard output is read by programs
+	var msgOut io.Writer = os.Stdout
+	if output.IsStructured(*output_fmt) {
+		msgOut = os.Stderr
+	}
 
-	user_cmd = os.Args[cmd_start_idx]
+	// config and template commands have a sub command, rollback and unlock have the system name
+	// and promote has the source environment
+	sub_cmd := ""
+	if (user_cmd == "config" || user_cmd == "template" || user_cmd == "rollback" || user_cmd == "promote" || user_cmd == "workspace" || user_cmd == "unlock") && len(positional) > 0 {
+		sub_cmd = positional[0]
+		positional = positional[1:]
+	}
+	if len(positional) > 1 {
+		printHelp(pgname)
+		return
+	} else if len(positional) == 1 {
+		user_env = positional[0]
+	}
+	if render_env != nil && *render_env != "" {
+		user_env = *render_env
+	}
 
 	config := cfg.NewConfig()
+	if err := config.LoadProject(); err != nil {
+		fmt.Println("Failed to load the project config:", err)
+		return
+	}
+	if render_mode != nil && *render_mode != "" {
+		if err := config.SetRenderMode(*render_mode); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 
 	// open log file
 	if _, err := os.Stat(config.ConfPath); os.IsNotExist(err) { // Create Path if not present
@@ -110,51 +363,293 @@ func main() {
 	// Set log out put and enjoy :)
 	log.SetOutput(logFile)
 
+	// the commands rendering into the .cache folders or running terraform lock the systems of the environment
+	lock_cmd, lock_system, lock_env := false, "", user_env
 	switch user_cmd {
-	case "init": // handle init command
-
-		file, err := os.Open(config.Modfile)
+	case "plan", "apply", "destroy":
+		lock_cmd = true
+	case "validate", "output":
+		lock_cmd, lock_system = true, *render_system
+	case "render":
+		lock_cmd, lock_system = *render_out == "" && !*render_stdout, *render_system
+	case "rollback":
+		lock_cmd, lock_system = sub_cmd != "" && !*rollback_list, sub_cmd
+	case "workspace":
+		// the workspaces are not bound to an environment, all the systems are locked
+		lock_cmd, lock_system, lock_env = sub_cmd == "delete" || sub_cmd == "prune", *render_system, *render_env
+	}
+	unlock_systems := func() {}
+	if lock_cmd {
+		unlock_systems, err = vplan.LockSystems(&config, lock_env, lock_system, user_cmd)
 		if err != nil {
-			log.Println("Failed to open file:", config.Modfile)
-			log.Println("Error:", err)
-			fmt.Println("Failed to access the terraform file:", config.Modfile)
+			fmt.Fprintf(os.Stderr, "\n%s failed: %v\n", user_cmd, err)
 			return
 		}
-		defer file.Close()
+	}
+	defer unlock_systems()
+
+	switch user_cmd {
+	case "init": // handle init command
+
+		// template of an existing system is resolved by init
+		source := *init_template
+		if source == "" && *init_system == "" {
+			source = config.Modfile
+		}
+		if source != "" {
+			if _, err := vtemplate.Load(&config, source); err != nil {
+				log.Println("Failed to load template:", source)
+				log.Println("Error:", err)
+				fmt.Println("Failed to access the terraform template:", source)
+				return
+			}
+		}
 
 		var saveConfFile string
-		saveConfFile, err = vinit.VdexInit(&config, user_env)
-		if err != nil {
+		saveConfFile, err = vinit.VdexInit(&config, user_env, *init_system, *init_template)
+		if errors.Is(err, vinit.ErrNotSaved) {
+			fmt.Printf("\ninit skipped - %v\n", err)
+		} else if err != nil {
+			printDiagnostics(err)
 			fmt.Printf("\ninit failed, see logs %s\n", logFileLocation)
 		} else {
 			fmt.Printf("\ninit Success - config is saved in %s\n", saveConfFile)
 		}
 	case "plan": // handle plan command
+		var results []vplan.RunResult
 		fileList, err := vplan.VdexPlanGen(&config, user_env)
 		if err != nil {
-			fmt.Printf("\nplan generation failed, see logs %s\n", logFileLocation)
+			printGenerationFailure(msgOut, err, logFileLocation)
 		} else {
 			if len(fileList) > 0 {
-				fmt.Printf("\nplan generation Success - generated files %v\n", fileList)
-				vplan.VdexTerraformExecute(&config, fileList, "plan", apply_tf_init, user_env)
+				fmt.Fprintf(msgOut, "\nplan generation Success - generated files %v\n", fileList)
+				results, _ = vplan.VdexTerraformExecute(&config, fileList, "plan", apply_tf_init, user_env, msgOut)
 			} else {
-				fmt.Printf("\nplan generation skipped - no config file is found, try init \n")
+				fmt.Fprintf(msgOut, "\nplan generation skipped - no config file is found, try init \n")
 			}
 		}
+		printResults(*output_fmt, results)
 	case "apply": // handle apply command
+		var results []vplan.RunResult
 		fileList, err := vplan.VdexPlanGen(&config, user_env)
 		if err != nil {
-			fmt.Printf("\nplan generation failed, see logs %s\n", logFileLocation)
+			printGenerationFailure(msgOut, err, logFileLocation)
 		} else {
 			if len(fileList) > 0 {
-				fmt.Printf("\nplan generation Success - generated files %v\n", fileList)
-				vplan.VdexTerraformExecute(&config, fileList, "apply", apply_tf_init, user_env)
+				fmt.Fprintf(msgOut, "\nplan generation Success - generated files %v\n", fileList)
+				results, _ = vplan.VdexTerraformExecute(&config, fileList, "apply", apply_tf_init, user_env, msgOut)
+			} else {
+				fmt.Fprintf(msgOut, "\nplan generation skipped - no config file is found, try init \n")
+			}
+		}
+		printResults(*output_fmt, results)
+	case "destroy": // handle destroy command
+		var results []vplan.RunResult
+		fileList, err := vplan.VdexPlanGen(&config, user_env)
+		if err != nil {
+			printGenerationFailure(msgOut, err, logFileLocation)
+		} else if len(fileList) == 0 {
+			fmt.Fprintf(msgOut, "\ndestroy skipped - no config file is found\n")
+		} else if vinit.Confirm(bufio.NewReader(os.Stdin), fmt.Sprintf("Destroy the resources of the systems of environment %s?", user_env)) {
+			results, _ = vplan.VdexTerraformExecute(&config, fileList, "destroy", apply_tf_init, user_env, msgOut)
+		} else {
+			fmt.Fprintf(msgOut, "\ndestroy cancelled\n")
+		}
+		printResults(*output_fmt, results)
+	case "graph": // handle graph command
+		if err := vplan.VdexGraph(&config, user_env, *graph_format, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "\ngraph failed: %v, see logs %s\n", err, logFileLocation)
+		}
+	case "render": // handle render command
+		fileList, err := vplan.VdexRender(&config, user_env, *render_system, *render_out, *render_stdout, os.Stdout)
+		if err != nil {
+			printDiagnostics(err)
+			fmt.Fprintf(os.Stderr, "\nrender failed: %v, see logs %s\n", err, logFileLocation)
+			// the exit status fails the pipelines
+			unlock_systems()
+			logFile.Close()
+			os.Exit(1)
+		} else if len(fileList) == 0 {
+			fmt.Fprintf(os.Stderr, "\nrender skipped - no config file is found, try init \n")
+		} else if !*render_stdout {
+			fmt.Printf("\nrender Success - generated files %v\n", fileList)
+		}
+	case "diff": // handle diff command
+		changes, err := vplan.VdexDiff(&config, user_env, *render_system, *diff_against, *diff_color, *diff_json, os.Stdout)
+		if err != nil {
+			printDiagnostics(err)
+			fmt.Fprintf(os.Stderr, "\ndiff failed: %v, see logs %s\n", err, logFileLocation)
+		} else if len(changes) == 0 && !*diff_json {
+			fmt.Printf("No changes in the generated files\n")
+		}
+	case "validate": // handle validate command
+		report, err := vplan.VdexValidate(&config, user_env, *render_system, *skip_terraform)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nvalidate failed: %v, see logs %s\n", err, logFileLocation)
+			unlock_systems()
+			logFile.Close()
+			os.Exit(1)
+		}
+		if output.IsStructured(*output_fmt) {
+			if err := output.Write(os.Stdout, *output_fmt, report); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		} else {
+			for _, d := range report.Diagnostics {
+				fmt.Println(d.String())
+			}
+		}
+		if report.Systems == 0 {
+			fmt.Fprintf(msgOut, "\nvalidate skipped - no config file is found, try init \n")
+		} else if report.Errors > 0 {
+			fmt.Fprintf(msgOut, "\nvalidate failed - %d systems, %d errors, %d warnings\n", report.Systems, report.Errors, report.Warnings)
+			// the exit status fails the pipelines
+			unlock_systems()
+			logFile.Close()
+			os.Exit(1)
+		} else {
+			fmt.Fprintf(msgOut, "\nvalidate Success - %d systems, %d warnings\n", report.Systems, report.Warnings)
+		}
+	case "history": // handle history command
+		// all the environments unless one is named
+		hist_env := *render_env
+		if hist_env == "" && len(positional) == 1 {
+			hist_env = positional[0]
+		}
+		since, err := vhistory.ParseSince(*hist_since, time.Now())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		entries, err := vhistory.Query(&config, vhistory.Filter{System: *render_system, Environment: hist_env, Since: since})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nhistory failed: %v, see logs %s\n", err, logFileLocation)
+		} else if len(entries) == 0 && !output.IsStructured(*output_fmt) {
+			fmt.Println("No plan or apply is recorded")
+		} else if err := vplan.WriteHistory(os.Stdout, *output_fmt, entries); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	case "rollback": // handle rollback command
+		if sub_cmd == "" {
+			printHelp(pgname)
+			return
+		}
+		if *rollback_list {
+			snaps, err := vsnapshot.List(&config, sub_cmd, user_env)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\nrollback failed: %v, see logs %s\n", err, logFileLocation)
+			} else if len(snaps) == 0 && !output.IsStructured(*output_fmt) {
+				fmt.Printf("No snapshot of %s in environment %s, snapshots are taken by apply\n", sub_cmd, user_env)
+			} else if err := vplan.WriteSnapshots(os.Stdout, *output_fmt, snaps); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			return
+		}
+		reader := bufio.NewReader(os.Stdin)
+		confirm := func(question string) bool {
+			return vinit.Confirm(reader, question)
+		}
+		results, err := vplan.VdexRollback(&config, sub_cmd, user_env, *rollback_to, confirm, msgOut)
+		if err != nil {
+			printDiagnostics(err)
+			fmt.Fprintf(os.Stderr, "\nrollback failed: %v, see logs %s\n", err, logFileLocation)
+		} else if len(results) == 0 || results[len(results)-1].Command != "apply" {
+			fmt.Fprintf(msgOut, "\nrollback cancelled\n")
+		} else if results[len(results)-1].Status == vplan.RUN_SUCCESS {
+			fmt.Fprintf(msgOut, "\nrollback Success\n")
+		} else {
+			fmt.Fprintf(msgOut, "\nrollback failed - apply failed, see logs %s\n", logFileLocation)
+		}
+		printResults(*output_fmt, results)
+	case "unlock": // handle unlock command
+		if sub_cmd == "" {
+			printHelp(pgname)
+			return
+		}
+		reader := bufio.NewReader(os.Stdin)
+		confirm := func(question string) bool {
+			return vinit.Confirm(reader, question)
+		}
+		removed, err := vplan.VdexUnlock(&config, sub_cmd, confirm, os.Stdout)
+		if err != nil {
+			fmt.Printf("\nunlock failed: %v, see logs %s\n", err, logFileLocation)
+		} else if removed {
+			fmt.Printf("\nunlock Success - %s is unlocked\n", sub_cmd)
+		}
+	case "promote": // handle promote command
+		if sub_cmd == "" || len(positional) != 1 {
+			printHelp(pgname)
+			return
+		}
+		promoted, err := vinit.VdexPromote(&config, sub_cmd, user_env, *render_system)
+		if err != nil {
+			fmt.Printf("\npromote failed: %v, see logs %s\n", err, logFileLocation)
+		} else {
+			fmt.Printf("\npromote Success - %d config files written\n", len(promoted))
+		}
+	case "output": // handle output command
+		outputs, err := vplan.VdexOutput(&config, user_env, *render_system, *out_write, msgOut)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\noutput failed: %v, see logs %s\n", err, logFileLocation)
+		}
+		if len(outputs) > 0 || output.IsStructured(*output_fmt) {
+			if err := vplan.WriteOutputs(os.Stdout, *output_fmt, outputs); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	case "workspace": // handle workspace sub commands
+		reader := bufio.NewReader(os.Stdin)
+		confirm := func(question string) bool {
+			return vinit.Confirm(reader, question)
+		}
+		switch {
+		case sub_cmd == "list" && len(positional) == 0:
+			if err := vlist.ListWorkSpaces(&config, *render_system, *render_env, *output_fmt, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "\nworkspace list failed: %v\n", err)
+			}
+		case sub_cmd == "delete" && len(positional) == 1:
+			deleted, err := vlist.DeleteWorkspace(&config, *render_system, *render_env, positional[0], confirm, os.Stdout)
+			if err != nil {
+				fmt.Printf("\nworkspace delete failed: %v, see logs %s\n", err, logFileLocation)
 			} else {
-				fmt.Printf("\nplan generation skipped - no config file is found, try init \n")
+				fmt.Printf("\nworkspace delete Success - deleted from %d systems\n", len(deleted))
 			}
+		case sub_cmd == "prune" && len(positional) == 0:
+			pruned, err := vlist.PruneWorkspaces(&config, *render_system, *render_env, confirm, os.Stdout)
+			if err != nil {
+				fmt.Printf("\nworkspace prune failed: %v, see logs %s\n", err, logFileLocation)
+			} else {
+				fmt.Printf("\nworkspace prune Success - %d workspaces deleted\n", len(pruned))
+			}
+		default:
+			printHelp(pgname)
 		}
 	case "list":
-		vlist.ListSystems(&config, user_env)
+		if err := vlist.ListSystems(&config, user_env, *output_fmt, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "\nlist failed: %v\n", err)
+		}
+	case "template": // handle template sub commands
+		if sub_cmd != "new" || *tmpl_module == "" {
+			printHelp(pgname)
+			return
+		}
+		err := vtemplate.VdexTemplateNew(&config, *tmpl_module, *tmpl_name, *tmpl_out, *tmpl_all, *tmpl_force)
+		if err != nil {
+			fmt.Printf("\ntemplate generation failed: %v\n", err)
+		} else if *tmpl_out != "-" {
+			fmt.Printf("\ntemplate generation Success - template is saved in %s\n", *tmpl_out)
+		}
+	case "config": // handle config sub commands
+		if sub_cmd != "convert" {
+			printHelp(pgname)
+			return
+		}
+		converted, err := vconvert.VdexConvert(&config, user_env, *conv_system, *conv_to, *conv_all)
+		if err != nil {
+			fmt.Printf("\nconvert failed: %v, see logs %s\n", err, logFileLocation)
+		} else {
+			fmt.Printf("\nconvert Success - %d config files converted\n", len(converted))
+		}
 	default:
 		printHelp(pgname)
 		return
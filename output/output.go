@@ -0,0 +1,137 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the command output
+const (
+	// aligned columns for the terminal
+	FORMAT_TABLE = "table"
+	FORMAT_JSON  = "json"
+	FORMAT_YAML  = "yaml"
+)
+
+/*
+ * Returns error if the format is not one of table, json or yaml
+ */
+func CheckFormat(format string) error {
+	switch format {
+	case FORMAT_TABLE, FORMAT_JSON, FORMAT_YAML:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q, use %s, %s or %s", format, FORMAT_TABLE, FORMAT_JSON, FORMAT_YAML)
+}
+
+/*
+ * Returns true if the format is read by programs, the messages for the user
+ * should not be written to the standard output then
+ */
+func IsStructured(format string) bool {
+	return format == FORMAT_JSON || format == FORMAT_YAML
+}
+
+/*
+ * Writes the value to w as json or yaml, the field names are taken from the json and yaml tags
+ */
+func Write(w io.Writer, format string, v any) error {
+	switch format {
+	case FORMAT_JSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case FORMAT_YAML:
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	return fmt.Errorf("format %q can not be written as a value", format)
+}
+
+// structure holds the rows of a table, the columns are as wide as their widest cell
+type Table struct {
+	// titles of the columns
+	Header []string
+	// cells of the rows
+	Rows [][]string
+}
+
+/*
+ * Returns a new table with the column titles
+ */
+func NewTable(header ...string) *Table {
+	return &Table{Header: header}
+}
+
+/*
+ * Adds a row, missing cells are empty
+ */
+func (t *Table) Add(cells ...string) {
+	t.Rows = append(t.Rows, cells)
+}
+
+/*
+ * Writes the table to w, the header is underlined with dashes
+ */
+func (t *Table) Write(w io.Writer) error {
+	widths := make([]int, len(t.Header))
+	for i, h := range t.Header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, r := range t.Rows {
+		for i := 0; i < len(r) && i < len(widths); i++ {
+			widths[i] = max(widths[i], utf8.RuneCountInString(r[i]))
+		}
+	}
+
+	dashes := make([]string, len(widths))
+	for i, n := range widths {
+		dashes[i] = strings.Repeat("-", n)
+	}
+
+	var sb strings.Builder
+	writeRow(&sb, t.Header, widths)
+	writeRow(&sb, dashes, widths)
+	for _, r := range t.Rows {
+		writeRow(&sb, r, widths)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writes the cells padded to the widths, the last column is not padded
+func writeRow(sb *strings.Builder, cells []string, widths []int) {
+	var line strings.Builder
+	for i, n := range widths {
+		cell := ""
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		if i > 0 {
+			line.WriteString(" ")
+		}
+		line.WriteString(cell)
+		if i < len(widths)-1 {
+			line.WriteString(strings.Repeat(" ", n-utf8.RuneCountInString(cell)))
+		}
+	}
+	sb.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity of a diagnostic
+type Severity int
+
+const (
+	SEV_ERROR   Severity = 1
+	SEV_WARNING Severity = 2
+)
+
+func (s Severity) String() string {
+	if s == SEV_WARNING {
+		return "warning"
+	}
+	return "error"
+}
+
+// severity is written by name in json and yaml
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// structure holds a problem found while parsing a terraform file
+type Diagnostic struct {
+	Severity Severity `json:"severity" yaml:"severity"`
+	// file name as passed to the parser
+	File string `json:"file" yaml:"file"`
+	// line and column of the problem, both start from 1
+	Line   int `json:"line" yaml:"line"`
+	Column int `json:"column" yaml:"column"`
+	// description of the problem
+	Message string `json:"message" yaml:"message"`
+	// source line of the problem
+	Snippet string `json:"snippet,omitempty" yaml:"snippet,omitempty"`
+}
+
+/*
+ * Formats the diagnostic compiler style, the snippet is followed by a marker under the column
+ * main.tf:12:11: error: string is not closed
+ */
+func (d Diagnostic) String() string {
+	var sb strings.Builder
+	if d.Line > 0 {
+		fmt.Fprintf(&sb, "%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Severity, d.Message)
+	} else {
+		// the problem has no position in the file
+		fmt.Fprintf(&sb, "%s: %s: %s", d.File, d.Severity, d.Message)
+	}
+	if d.Snippet != "" {
+		sb.WriteString("\n    " + d.Snippet + "\n    ")
+		// keep the tabs of the snippet so that the marker lines up
+		for i := 0; i < d.Column-1 && i < len(d.Snippet); i++ {
+			if d.Snippet[i] == '\t' {
+				sb.WriteByte('\t')
+			} else {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString("^")
+	}
+	return sb.String()
+}
+
+// list of the diagnostics, it is returned as error when it has errors
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	var lines []string
+	for _, d := range ds {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+ * Returns true if any of the diagnostics is an error
+ */
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SEV_ERROR {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package parser_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"vdex/parser"
+)
+
+func TestDiagnosticPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		line    int
+		column  int
+		snippet string
+	}{
+		{"missing value", "a {\n  b =\n}\n", 2, 6, "  b ="},
+		{"extra brace", "a {\n  b = 1\n}\n}\n", 4, 1, "}"},
+		{"after single line block", "a { b = 1 } }\n", 1, 13, "a { b = 1 } }"},
+		{"assignment after single line block", "a { b = 1 } = 2\n", 1, 13, "a { b = 1 } = 2"},
+		{"after multi line value", "a { b = [\n  1,\n] } }\n", 3, 5, "] } }"},
+		{"unclosed block", "a {\n  b = 1\n", 1, 3, "a {"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.Parse(strings.NewReader(tt.input), "main.tf")
+			var diags parser.Diagnostics
+			if !errors.As(err, &diags) || len(diags) == 0 {
+				t.Fatalf("Parse returned %v, want diagnostics", err)
+			}
+			d := diags[0]
+			if d.Line != tt.line || d.Column != tt.column || d.Snippet != tt.snippet {
+				t.Errorf("got %d:%d %q, want %d:%d %q\n%v", d.Line, d.Column, d.Snippet, tt.line, tt.column, tt.snippet, diags)
+			}
+		})
+	}
+}
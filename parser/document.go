@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+)
+
+// structure holds a parsed terraform file
+type Document struct {
+	// name of the input, used as the file of the diagnostics
+	Name string
+	// top level blocks in the order of the input
+	Blocks []TFBlock
+	// flat view of the top level blocks
+	Modules []ModuleBlock
+	// REPLACE-ME params as found in the input, by key (eg: module "echo".foo)
+	Params map[string]ParamValue
+	// text of the input, the document is rendered from it
+	source []byte
+}
+
+// options of the rendering
+type RenderOptions struct {
+	// renders the REPLACE-ME params as variable references (var.<name>) instead of the values
+	VarRefs bool
+	// optional function that maps the key of a param to the key of the values
+	KeyFunc func(key string) string
+}
+
+/*
+ * Parses the terraform text read from r, name is used as the file of the diagnostics
+ * Returns
+ * the parsed document
+ * error: Diagnostics with the position of each problem if the text has errors
+ */
+func Parse(r io.Reader, name string) (*Document, error) {
+	source, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tfbs, err := parseStream(bytes.NewReader(source), name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{
+		Name:    name,
+		Blocks:  tfbs.TFList,
+		Modules: tfbs.MList,
+		Params:  tfbs.Schema,
+		source:  source,
+	}, nil
+}
+
+/*
+ * Writes the document to w with the REPLACE-ME params replaced by the values
+ * values are keyed like Document.Params, params without value keep the value of the document
+ */
+func Render(doc *Document, values map[string]string, w io.Writer) error {
+	return RenderWith(doc, values, w, RenderOptions{})
+}
+
+/*
+ * Writes the document to w like Render with the options
+ * Nothing is written to w if the document can not be rendered
+ */
+func RenderWith(doc *Document, values map[string]string, w io.Writer, opts RenderOptions) error {
+	tfbs := CreateTFBlocks()
+	for k, v := range values {
+		tfbs.Param[k] = ParamValue{P_value: v}
+	}
+	tfbs.Skip = true
+	tfbs.VarRefs = opts.VarRefs
+	tfbs.KeyFunc = opts.KeyFunc
+
+	_, err := parseStream(bytes.NewReader(doc.source), doc.Name, &tfbs, w)
+	return err
+}
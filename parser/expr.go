@@ -0,0 +1,310 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Symbols of the terraform expressions
+const (
+	PARENBEGIN byte   = '('
+	PARENEND   byte   = ')'
+	HEREDOC    string = "<<"
+	COMMENTEND string = "*/"
+	TEMPLATE1  string = "${"
+	TEMPLATE2  string = "%{"
+)
+
+// marks an open template interpolation ${ } in the bracket stack
+const interpolation byte = '$'
+
+// structure holds the result of scanning an expression
+type Expr struct {
+	// entire text of the expression, it may span multiple lines
+	Text string
+	// comment on the first line of a multi line expression (eg: tags = { // REPLACE-ME)
+	FirstComment string
+	// comment after the end of the expression (eg: foo = 5 // REPLACE-ME)
+	TrailComment string
+	// number of lines read after the first line
+	Lines int
+	// false if a bracket, a string or a heredoc is not closed
+	Complete bool
+	// describes why the expression is not complete
+	Problem string
+	// position of the problem, line is relative to the first line and column starts from 0
+	ProblemLine   int
+	ProblemColumn int
+	// text after the end of the expression on its last line (eg: the "}" of a single line block)
+	Rest string
+}
+
+// an open symbol of the expression and its position
+type symbol struct {
+	c    byte
+	line int
+	col  int
+}
+
+// returns the name of the open symbol for the messages
+func symbolName(c byte) string {
+	switch c {
+	case STRDELIM:
+		return "string"
+	case interpolation:
+		return "interpolation \"${\""
+	}
+	return fmt.Sprintf("bracket '%c'", c)
+}
+
+// records the problem of the expression at the position
+func (expr *Expr) problem(line int, col int, format string, args ...any) {
+	expr.Problem = fmt.Sprintf(format, args...)
+	expr.ProblemLine = line
+	expr.ProblemColumn = col
+}
+
+// records the innermost open symbol as the problem
+func (expr *Expr) unclosed(stack []symbol) {
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		expr.problem(top.line, top.col, "%s is not closed", symbolName(top.c))
+	}
+}
+
+// returns the marker of the heredoc that starts at i (<<EOT or <<-EOT) and the index after it
+func heredocMarker(text string, i int) (string, int) {
+	j := i + len(HEREDOC)
+	if j < len(text) && text[j] == '-' {
+		j++
+	}
+	k := j
+	for k < len(text) && (isIdentByte(text[k]) || (k > j && text[k] == '-')) {
+		k++
+	}
+	if k == j || (k > j && text[j] >= '0' && text[j] <= '9') {
+		return "", i
+	}
+	return text[j:k], k
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// returns true if the text before an assignment in a map ends with the name of the element
+func hasName(text string) bool {
+	text = strings.TrimRight(text, " \t")
+	return text != "" && !strings.HasSuffix(text, string(BLKBEGIN)) && !strings.HasSuffix(text, ",")
+}
+
+// returns true if the "=" at i is an assignment, not a part of == != <= >= or =>
+func isAssign(text string, i int) bool {
+	if i > 0 && strings.IndexByte("=!<>", text[i-1]) >= 0 {
+		return false
+	}
+	return i+1 >= len(text) || (text[i+1] != '=' && text[i+1] != '>')
+}
+
+// returns the closing symbol of the opening bracket
+func closerOf(c byte) byte {
+	switch c {
+	case PARENBEGIN:
+		return PARENEND
+	case LISTBEGIN:
+		return LISTEND
+	}
+	return BLKEND
+}
+
+/*
+ * Scans the terraform expression at the start of the text, the expression continues on the lines
+ * returned by next as long as a bracket, a function call, an interpolation or a heredoc is open
+ * Comments inside a multi line expression are kept in the text, a comment after the end is not
+ * A quoted string can not span lines, such an expression is incomplete
+ */
+func ScanExpr(text string, next func() (string, bool)) Expr {
+	var expr Expr
+	var sb strings.Builder
+	// open brackets, STRDELIM for strings and interpolation for ${ }
+	var stack []symbol
+
+	line := text
+	first := true
+	for {
+		end := 0
+		heredoc := ""
+		n := len(line)
+
+	scan:
+		for i := 0; i < n; {
+			c := line[i]
+			if len(stack) > 0 && stack[len(stack)-1].c == STRDELIM {
+				switch {
+				case c == ESCAPESEQ:
+					i++
+				case c == STRDELIM:
+					stack = stack[:len(stack)-1]
+				case strings.HasPrefix(line[i:], TEMPLATE1) || strings.HasPrefix(line[i:], TEMPLATE2):
+					stack = append(stack, symbol{interpolation, expr.Lines, i})
+					i++
+				}
+				i++
+				end = min(i, n)
+				continue
+			}
+
+			switch {
+			case c == ' ' || c == '\t':
+				i++
+				continue
+			case c == COMMENT2[0] || strings.HasPrefix(line[i:], COMMENT1):
+				comment := strings.TrimSpace(line[i:])
+				switch {
+				case len(stack) == 0:
+					expr.TrailComment = comment
+				case first:
+					expr.FirstComment = comment
+					end = n
+				default:
+					end = n
+				}
+				break scan
+			case strings.HasPrefix(line[i:], COMMENT3):
+				k := strings.Index(line[i+len(COMMENT3):], COMMENTEND)
+				startLine, startCol := expr.Lines, i
+				for k < 0 {
+					sb.WriteString(line + "\n")
+					more, ok := next()
+					if !ok {
+						expr.Text = strings.TrimRight(sb.String(), "\n")
+						expr.problem(startLine, startCol, "comment is not closed")
+						return expr
+					}
+					expr.Lines++
+					first = false
+					line, n, i = more, len(more), 0
+					k = strings.Index(line, COMMENTEND) - len(COMMENT3)
+				}
+				i += len(COMMENT3) + k + len(COMMENTEND)
+				if len(stack) > 0 {
+					end = i
+				}
+				continue
+			case strings.HasPrefix(line[i:], HEREDOC):
+				if marker, k := heredocMarker(line, i); marker != "" {
+					heredoc = marker
+					expr.problem(expr.Lines, i, "heredoc %s is not closed", marker)
+					end = k
+					// only a comment can follow the marker
+					if comment := strings.TrimSpace(line[k:]); comment != "" && first {
+						expr.FirstComment = comment
+					}
+					break scan
+				}
+				i += len(HEREDOC)
+			case c == STRDELIM || c == PARENBEGIN || c == LISTBEGIN || c == BLKBEGIN:
+				stack = append(stack, symbol{c, expr.Lines, i})
+				i++
+			case c == BLKASSIGN && len(stack) == 0 && isAssign(line, i):
+				// an assignment can not be part of the expression
+				expr.Rest = line[end:]
+				break scan
+			case c == BLKASSIGN && len(stack) > 0 && stack[len(stack)-1].c == BLKBEGIN && isAssign(line, i) && !hasName(line[:i]):
+				sb.WriteString(line[:i+1])
+				expr.Text = sb.String()
+				expr.problem(expr.Lines, i, "name is missing before '='")
+				return expr
+			case c == PARENEND || c == LISTEND || c == BLKEND:
+				if len(stack) == 0 {
+					// end of the enclosing block
+					expr.Rest = line[end:]
+					break scan
+				}
+				top := stack[len(stack)-1].c
+				if (top == interpolation && c != BLKEND) || (top != interpolation && closerOf(top) != c) {
+					sb.WriteString(line[:i+1])
+					expr.Text = sb.String()
+					expr.problem(expr.Lines, i, "unexpected '%c', %s is open", c, symbolName(top))
+					return expr
+				}
+				stack = stack[:len(stack)-1]
+				i++
+			default:
+				i++
+			}
+			end = i
+		}
+
+		// trimmed like the value is trimmed, so the rendered value scans the same
+		sb.WriteString(strings.TrimRightFunc(line[:end], unicode.IsSpace))
+		if heredoc != "" {
+			// the body ends with the line that holds only the marker
+			for closed := false; !closed; {
+				more, ok := next()
+				if !ok {
+					expr.Text = sb.String()
+					return expr
+				}
+				expr.Lines++
+				sb.WriteString("\n" + more)
+				closed = strings.TrimSpace(more) == heredoc
+			}
+			expr.Problem = ""
+		}
+		if len(stack) == 0 || stack[len(stack)-1].c == STRDELIM {
+			expr.Text = sb.String()
+			expr.Complete = len(stack) == 0
+			expr.unclosed(stack)
+			return expr
+		}
+
+		more, ok := next()
+		if !ok {
+			expr.Text = sb.String()
+			expr.unclosed(stack)
+			return expr
+		}
+		expr.Lines++
+		sb.WriteString("\n")
+		line = more
+		first = false
+	}
+}
+
+/*
+ * Returns the index of the symbol that closes the string or bracket at the start of the text
+ * Returns -1 if it is not closed
+ */
+func closingIndex(text string) int {
+	var stack []byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if len(stack) > 0 && stack[len(stack)-1] == STRDELIM {
+			switch {
+			case c == ESCAPESEQ:
+				i++
+			case c == STRDELIM:
+				stack = stack[:len(stack)-1]
+			case strings.HasPrefix(text[i:], TEMPLATE1) || strings.HasPrefix(text[i:], TEMPLATE2):
+				stack = append(stack, interpolation)
+				i++
+			}
+		} else {
+			switch c {
+			case STRDELIM, PARENBEGIN, LISTBEGIN, BLKBEGIN:
+				stack = append(stack, c)
+			case PARENEND, LISTEND, BLKEND:
+				if len(stack) == 0 {
+					return -1
+				}
+				stack = stack[:len(stack)-1]
+			}
+		}
+		if len(stack) == 0 {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,127 @@
+package parser_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"vdex/parser"
+)
+
+// inputs shared by the fuzz targets
+var seeds = []string{
+	"",
+	" ",
+	"5",
+	"5 // REPLACE-ME",
+	"\"hello\" // REPLACE-ME",
+	"\"REPLACE-ME\"",
+	"\"Val \\\"50\\\"\"",
+	"[\"30\",\"40\"] // REPLACE-ME",
+	"[\n  1,\n  2\n] // REPLACE-ME",
+	"{",
+	"{ // REPLACE-ME\n  a = 1\n}",
+	"{ a = 1, b = [2] }",
+	"<<EOT\nhello\nEOT",
+	"<<-EOT // REPLACE-ME\n  hello ${var.x}\n  EOT",
+	"format(\"%s-%s\",\n  var.a,\n  var.b)",
+	"\"${var.env}-app\"",
+	"true",
+	"null",
+	"module.vpc.ids[0]",
+	"\"unclosed",
+	"[1, 2}",
+	"/* comment",
+	"# comment",
+	"// comment",
+	"module \"echo\" {",
+	"terraform {",
+	"}",
+}
+
+// returns a parser reading the text
+func newParser(text string) *parser.TFParser {
+	tfp := parser.CreateTFParser()
+	tfp.SetScanner(bufio.NewScanner(strings.NewReader(text)))
+	return &tfp
+}
+
+func FuzzParseValue(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		line, more, _ := strings.Cut(text, "\n")
+		tfp := newParser(more)
+		value := tfp.ParseValue(line)
+
+		// a value that ends on its line is taken from the line
+		if more == "" && !strings.Contains(line, value.P_value) {
+			t.Errorf("ParseValue(%q) = %q, not part of the input", line, value.P_value)
+		}
+		if value.P_value == parser.REPLACE2 && !value.P_replace {
+			t.Errorf("ParseValue(%q) is not marked for replace", line)
+		}
+	})
+}
+
+func FuzzParseBlockType(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		line, more, _ := strings.Cut(text, "\n")
+		tfp := newParser(more)
+		idx, n := tfp.ParseBlockType(line)
+		if idx < -1 || idx > 12 {
+			t.Errorf("ParseBlockType(%q) returned the type %d", line, idx)
+		}
+		if n < 0 || n > len(line) {
+			t.Errorf("ParseBlockType(%q) returned the length %d", line, n)
+		}
+	})
+}
+
+func FuzzProcessStream(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	for _, s := range goldenInputs(f) {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		tfbs := parser.CreateTFBlocks()
+		tfp := newParser(text)
+		tfp.ProcessStream(&tfbs)
+
+		doc, err := parser.Parse(strings.NewReader(text), "fuzz.tf")
+		if err != nil {
+			if _, ok := err.(parser.Diagnostics); !ok {
+				t.Fatalf("Parse(%q) failed with %v", text, err)
+			}
+			return
+		}
+
+		// the scanner drops the carriage return of the line ends, the text is not rendered as is
+		if strings.Contains(text, "\r") {
+			return
+		}
+
+		// rendering a valid document never fails and renders the same text again
+		var out bytes.Buffer
+		if err := parser.Render(doc, nil, &out); err != nil {
+			t.Fatalf("Render(%q) failed with %v", text, err)
+		}
+		again, err := parser.Parse(bytes.NewReader(out.Bytes()), "fuzz.tf")
+		if err != nil {
+			t.Fatalf("rendered text %q of %q does not parse: %v", out.String(), text, err)
+		}
+		var out2 bytes.Buffer
+		if err := parser.Render(again, nil, &out2); err != nil {
+			t.Fatalf("Render(%q) failed with %v", out.String(), err)
+		}
+		if out.String() != out2.String() {
+			t.Errorf("rendering is not stable\n%q\n%q", out.String(), out2.String())
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package parser_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"vdex/codec"
+	"vdex/parser"
+)
+
+// regenerates the golden files: go test ./parser -run TestGolden -update
+var update = flag.Bool("update", false, "update the golden files")
+
+// folder of the golden corpus, each case is a folder with
+// main.tf: the template
+// values.txt: the config values used to render the template (optional)
+// keys.golden: the REPLACE-ME params found in the template
+// rendered.golden: the template rendered with the values
+const goldenDir = "testdata/golden"
+
+// returns the folders of the golden cases
+func goldenCases(t testing.TB) []string {
+	entries, err := os.ReadDir(goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []string
+	for _, e := range entries {
+		if e.IsDir() {
+			cases = append(cases, filepath.Join(goldenDir, e.Name()))
+		}
+	}
+	return cases
+}
+
+// returns the templates of the golden cases
+func goldenInputs(t testing.TB) []string {
+	var inputs []string
+	for _, dir := range goldenCases(t) {
+		data, err := os.ReadFile(filepath.Join(dir, "main.tf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, string(data))
+	}
+	return inputs
+}
+
+// names of the value types in the golden files
+var typeNames = map[int]string{
+	parser.V_SCALAR:        "scalar",
+	parser.V_NUMERIC:       "numeric",
+	parser.V_BOOLEAN:       "boolean",
+	parser.V_STRING:        "string",
+	parser.V_LIST:          "list",
+	parser.V_REFERANCE:     "reference",
+	parser.V_MAP_OR_SET:    "map",
+	parser.V_NULL:          "null",
+	parser.V_INTERPOLATION: "interpolation",
+	parser.V_FUNCTION:      "function",
+}
+
+// formats the REPLACE-ME params of the document, one per line sorted by key
+func formatKeys(doc *parser.Document) string {
+	var sb strings.Builder
+	keys := make([]string, 0, len(doc.Params))
+	for k := range doc.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := doc.Params[k]
+		fmt.Fprintf(&sb, "%s (%s) = %s\n", k, typeNames[int(p.P_type)], p.P_value)
+		if len(p.P_refs) > 0 {
+			fmt.Fprintf(&sb, "    refs: %s\n", strings.Join(p.P_refs, ", "))
+		}
+		if p.P_env {
+			sb.WriteString("    env\n")
+		}
+	}
+	return sb.String()
+}
+
+// compares the text with the golden file, the file is written with -update
+func checkGolden(t *testing.T, file string, got string) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(file, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs\n%s", file, diffText(string(want), got))
+	}
+}
+
+// returns the lines that differ between want and got
+func diffText(want string, got string) string {
+	var sb strings.Builder
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(w) || i < len(g); i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			fmt.Fprintf(&sb, "line %d:\n- %s\n+ %s\n", i+1, wl, gl)
+		}
+	}
+	return sb.String()
+}
+
+// parses the template of the case
+func parseCase(t *testing.T, dir string) *parser.Document {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "main.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := parser.Parse(bytes.NewReader(data), "main.tf")
+	if err != nil {
+		t.Fatalf("Parse failed:\n%v", err)
+	}
+	return doc
+}
+
+// reads the config values of the case
+func caseValues(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "values.txt"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	values, err := codec.TextCodec{}.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func render(t *testing.T, doc *parser.Document, values map[string]string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := parser.Render(doc, values, &out); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	return out.String()
+}
+
+// returns the values of all the params of the blocks by key (eg: module "echo".foo)
+func blockValues(blocks []parser.TFBlock) map[string]string {
+	values := make(map[string]string)
+	var walk func(b *parser.TFBlock)
+	walk = func(b *parser.TFBlock) {
+		for k, p := range b.Params {
+			values[b.BlockfName+"."+k] = p.P_value
+		}
+		for _, c := range b.Child {
+			walk(c)
+		}
+	}
+	for i := range blocks {
+		walk(&blocks[i])
+	}
+	return values
+}
+
+func TestGolden(t *testing.T) {
+	for _, dir := range goldenCases(t) {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			doc := parseCase(t, dir)
+			checkGolden(t, filepath.Join(dir, "keys.golden"), formatKeys(doc))
+			checkGolden(t, filepath.Join(dir, "rendered.golden"), render(t, doc, caseValues(t, dir)))
+		})
+	}
+}
+
+// the rendered template is valid and holds the values of the config
+func TestRenderRoundTrip(t *testing.T) {
+	for _, dir := range goldenCases(t) {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			doc := parseCase(t, dir)
+			values := caseValues(t, dir)
+			rendered := render(t, doc, values)
+
+			again, err := parser.Parse(strings.NewReader(rendered), "rendered.tf")
+			if err != nil {
+				t.Fatalf("rendered template does not parse:\n%v", err)
+			}
+			if len(again.Params) != 0 {
+				t.Errorf("rendered template has REPLACE-ME params %v", again.Params)
+			}
+			got := blockValues(again.Blocks)
+			for k, p := range doc.Params {
+				want := p.P_value
+				if v, found := values[k]; found {
+					want = v
+				}
+				// a map that opens with "{" alone on the line is a sub block when parsed again
+				if strings.HasPrefix(want, "{\n") {
+					continue
+				}
+				if got[k] != want {
+					t.Errorf("%s = %q, want %q", k, got[k], want)
+				}
+			}
+
+			// rendering the rendered template changes nothing
+			if again := render(t, again, nil); again != rendered {
+				t.Errorf("rendering is not stable\n%s", diffText(rendered, again))
+			}
+		})
+	}
+}
+
+// rendering with the values of the template is the same as rendering without values
+func TestRenderDefaults(t *testing.T) {
+	for _, dir := range goldenCases(t) {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			doc := parseCase(t, dir)
+			defaults := make(map[string]string)
+			for k, p := range doc.Params {
+				defaults[k] = p.P_value
+			}
+			if got, want := render(t, doc, defaults), render(t, doc, nil); got != want {
+				t.Errorf("rendering with the defaults differs\n%s", diffText(want, got))
+			}
+		})
+	}
+}
+
+// a param without key in the values keeps the value of the template, an empty value renders empty
+func TestRenderMissingValues(t *testing.T) {
+	doc, err := parser.Parse(strings.NewReader("a {\n  b = 1 // REPLACE-ME\n  c = \"x\" // REPLACE-ME\n}\n"), "main.tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		values map[string]string
+		want   string
+	}{
+		{"no values", nil, "a {\n  b = 1\n  c = \"x\"\n}\n"},
+		{"one value", map[string]string{"a.b": "2"}, "a {\n  b = 2\n  c = \"x\"\n}\n"},
+		{"empty value", map[string]string{"a.b": ""}, "a {\n  b = \n  c = \"x\"\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(t, doc, tt.values); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,11 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -28,14 +30,16 @@ var blockTypes = []string{
 
 // Type of the Variable or Parameter Value
 const (
-	V_SCALAR     = 1
-	V_NUMERIC    = 2
-	V_BOOLEAN    = 3
-	V_STRING     = 4
-	V_LIST       = 5
-	V_REFERANCE  = 6
-	V_MAP_OR_SET = 7
-	V_NULL       = 8
+	V_SCALAR        = 1
+	V_NUMERIC       = 2
+	V_BOOLEAN       = 3
+	V_STRING        = 4
+	V_LIST          = 5
+	V_REFERANCE     = 6
+	V_MAP_OR_SET    = 7
+	V_NULL          = 8
+	V_INTERPOLATION = 9
+	V_FUNCTION      = 10
 )
 
 // Special Symbols in the terraform file
@@ -53,6 +57,8 @@ const (
 	COMMENT3  string = "/*"
 	REPLACE   string = "REPLACE-ME"
 	REPLACE2  string = "\"REPLACE-ME\""
+	// marks a value that differs per environment, eg: instance_type = "t3.micro" // REPLACE-ME env
+	REPLACE_ENV string = "REPLACE-ME env"
 )
 
 // TF Parameter Value structure
@@ -63,14 +69,21 @@ type ParamValue struct {
 	P_type valueType
 	// Boolean indicating whether the Parameter is to be replaced
 	P_replace bool
+	// Boolean indicating whether the value differs per environment (REPLACE-ME env comment)
+	P_env bool
+	// addresses of the blocks referenced by the value (eg: var.region, module.vpc)
+	P_refs []string
+	// first and last line of the value in the input, both start from 1
+	P_line    int
+	P_endline int
 }
 
 // structure to hold contents of a flat block like module
 type ModuleBlock struct {
 	// name of the block - "module <name>"
-	blockName string
-	// holds key value pairs of the block
-	params map[string]ParamValue
+	BlockName string
+	// holds key value pairs of the block and its sub blocks
+	Params map[string]ParamValue
 }
 
 // structure to hold contents of multi level block like provider
@@ -99,18 +112,35 @@ type TFBlocks struct {
 	TFList []TFBlock
 	// Map to store input param and the user input/config
 	Param map[string]ParamValue
+	// Map to store the REPLACE-ME params as found in the template
+	Schema map[string]ParamValue
 	// flag to indicate to fill Param
 	Skip bool
+	// flag to render the REPLACE-ME params as variable references (var.<name>) instead of the values
+	VarRefs bool
+	// optional function that maps the key of a param to the config key (eg: to qualify with the file name)
+	KeyFunc func(key string) string
 }
 
 // structure holds the input data stream for Parsing
 type TFParser struct {
 	// scanner
 	scan *bufio.Scanner
-	// logger
-	file *os.File
+	// output of the render mode, nil if not rendering
+	file io.Writer
 	// pending text
 	text string
+	// name of the input for the diagnostics
+	name string
+	// number of the last line read from the scanner
+	line int
+	// text that follows the last parsed value on its line
+	rest string
+	// line holding the rest and the column (starts from 0) of the rest in it
+	restLine string
+	restCol  int
+	// problems found while parsing
+	diags Diagnostics
 }
 
 // Return new ModuleBlock object
@@ -122,8 +152,8 @@ func CreateModuleBlock() ModuleBlock {
 
 // Initiate the maps of a ModuleBlock object
 func (mb *ModuleBlock) Init(name string) {
-	mb.blockName = name
-	mb.params = make(map[string]ParamValue)
+	mb.BlockName = name
+	mb.Params = make(map[string]ParamValue)
 }
 
 // Return new TFBlock object
@@ -147,169 +177,147 @@ func (tfb *TFBlock) Clear() {
 }
 
 /*
- * Takes string input along with current position and the lengh
- * Returns if the text contains double quoted value as boolean
- * and also returns the next byte position after the quoted value
+ * Parses the input text (which is RHS of a variable) and returns ParamValue object that contains
+ * -string the value of it after skimming undesired left and right such as comments, spaces
+ * -type of the value one of (SCALER, BOOLEAN, STRING, LIST, MAP)
+ * -bool indicating whether this value is eligible for ** REPLACE-IT **
+ * Multi line values (lists, maps, objects, heredocs and function calls) are read from the scanner
+ * A map opened with only "{" on the line is a sub block, its value is returned as "{"
  */
-func (tfp *TFParser) ParseStringValue(text string, i int, n int) (int, bool) {
-	i++
-	for ; i < n && (text[i] != STRDELIM); i++ {
-		// Handle value with escape sequence cases "Val \"50\""
-		if text[i] == ESCAPESEQ {
-			i++
-		}
-	}
-	if i < n && text[i] == STRDELIM {
-		return i + 1, true
-	}
-	return i, false
+func (tfp *TFParser) ParseValue(itext string) ParamValue {
+	return tfp.parseValue(itext, itext, 0)
 }
 
 /*
- * Takes string input along with current position and the lengh - parse the list object
- * Returns
- * int index where the list ends in the multi/single last line
- * boolean if the text contains valid list object
+ * Parses the value itext found at the column col (starts from 0) of the source line
+ * Problems of the value are added to the diagnostics at their position in the source
  */
-func (tfp *TFParser) ParseListValue(text string, i int, n int) (int, bool) {
+func (tfp *TFParser) parseValue(itext string, source string, col int) ParamValue {
+	var paramVal ParamValue
 
-	for i = i + 1; i < n && text[i] != LISTEND; {
-		if text[i] == STRDELIM {
-			i, _ = tfp.ParseStringValue(text, i, n)
-		} else {
-			i++
+	paramVal.P_type = V_SCALAR
+	tfp.rest = ""
+
+	text := strings.TrimSpace(itext)
+	col += len(itext) - len(strings.TrimLeft(itext, " \t"))
+	if text == "" {
+		tfp.errorf(tfp.line, col+1, source, "value is missing")
+		return paramVal
+	}
+
+	// Value is a sub block eg: tags = {
+	if text[0] == BLKBEGIN {
+		rest := strings.TrimSpace(text[1:])
+		if rest == "" || ((strings.HasPrefix(rest, COMMENT1) || strings.HasPrefix(rest, COMMENT2)) && !isMarker(rest)) {
+			paramVal.P_value = string(BLKBEGIN)
+			paramVal.P_type = V_MAP_OR_SET
+			return paramVal
 		}
 	}
 
-	if i < n && text[i] == LISTEND {
-		return i + 1, true
+	line := tfp.line
+	lines := []string{source}
+	expr := ScanExpr(text, func() (string, bool) {
+		more, ok := tfp.next()
+		if ok {
+			lines = append(lines, more)
+		}
+		return more, ok
+	})
+	value := expr.Text
+	tfp.rest = expr.Rest
+	tfp.restLine = lines[len(lines)-1]
+	tfp.restCol = len(tfp.restLine) - len(expr.Rest)
+	if expr.Lines == 0 {
+		tfp.restCol = col + len(text) - len(expr.Rest)
 	}
-	return i, false
-}
 
-/*
- * Takes string input along with current position and the lengh - parse the multi line list object
- * Returns
- * string that holds the entire list
- * string that holds the last line that is part of a multi/single line list
- * int index where the list ends in the multi/single last line
- * boolean if the text contains valid list object
- */
-func (tfp *TFParser) ParseMListValue(text string, i int, n int) (string, string, int, bool) {
-	var listEnd bool
-
-	ln := 0
-	listtext := text
-
-	ln, listEnd = tfp.ParseListValue(text, i, n)
-
-	if !listEnd {
-		ln = n
-		for !listEnd && tfp.scan.Scan() {
-			text = tfp.scan.Text()
-			n = len(text)
-			listtext += "\n" + text
-			i, listEnd = tfp.ParseListValue(text, -1, n)
-			ln += 1 + i
+	// Value is opened with REPLACE-ME comment eg: tags = { // REPLACE-ME
+	if isMarker(expr.FirstComment) {
+		paramVal.P_replace = true
+		paramVal.P_env = strings.HasSuffix(expr.FirstComment, REPLACE_ENV)
+		if idx := strings.Index(value, expr.FirstComment); idx >= 0 {
+			value = strings.TrimRight(value[:idx], " \t") + value[idx+len(expr.FirstComment):]
 		}
+	}
+	// Value is suffixed with REPLACE-ME comment eg: foo = 5 // REPLACE-ME
+	if isMarker(expr.TrailComment) {
+		paramVal.P_replace = true
+		paramVal.P_env = paramVal.P_env || strings.HasSuffix(expr.TrailComment, REPLACE_ENV)
+	}
+	// Value is "REPLACE-ME"
+	if value == REPLACE2 {
+		paramVal.P_replace = true
+	}
 
+	if value == "" {
+		tfp.errorf(line, col+1, source, "value is missing")
+	} else if expr.Problem != "" {
+		pcol := expr.ProblemColumn + 1
+		if expr.ProblemLine == 0 {
+			pcol += col
+		}
+		tfp.errorf(line+expr.ProblemLine, pcol, lines[min(expr.ProblemLine, len(lines)-1)], "%s", expr.Problem)
 	}
-	return listtext, text, ln, listEnd
+	paramVal.P_type = ValueType(value)
+	paramVal.P_value = value
+	paramVal.P_refs = References(value)
+	paramVal.P_line = line
+	paramVal.P_endline = line + expr.Lines
+	return paramVal
+}
+
+// returns true if the comment marks the value to be replaced, eg: // REPLACE-ME or // REPLACE-ME env
+func isMarker(comment string) bool {
+	return strings.HasSuffix(comment, REPLACE) || strings.HasSuffix(comment, REPLACE_ENV)
 }
 
 /*
- * Parses the input text (which is RHS of a variable) and returns ParamValue object that contains
- * -string the value of it after skimming undesired left and right such as comments, spaces
- * -type of the value one of (SCALER, BOOLEAN, STRING, LIST, MAP)
- * -bool indicating whether this value is eligible for ** REPLACE-IT **
+ * Returns the type of the value text
+ * a single quoted string or heredoc is STRING (INTERPOLATION if it has ${ } or %{ }),
+ * a single list is LIST, a single map/object is MAP, var.region is REFERANCE and merge(a, b) is FUNCTION
  */
-func (tfp *TFParser) ParseValue(itext string) ParamValue {
-	var paramVal ParamValue
-
-	paramVal.P_type = V_SCALAR
-
-	var replaceEligible bool
-	text := strings.TrimSpace(itext)
-	listtext := text
-
-	i := 0
-	n := len(text)
-	wstart := i
-	wend := n
-
-	switch text[i] {
-	case STRDELIM: // Value in quotation eg: "5"
-		wstart = i
-		var isValid bool
-		wend, isValid = tfp.ParseStringValue(text, i, n)
-		if !isValid {
-			log.Println("Invalid string format ", text)
-		}
-		paramVal.P_type = V_STRING
-	case LISTBEGIN: // Value is a list/array
-		var isValid bool
-		//wend, isValid = tfp.ParseListValue(text, i, n)
-		listtext, _, wend, isValid = tfp.ParseMListValue(text, i, n)
-		text = listtext
-		n = len(text)
-		//fmt.Printf("LISTBE:%s:%s:", text, string(text[wstart:wend]))
-		if !isValid {
-			log.Println("Invalid List format ", text)
-		}
-		paramVal.P_type = V_LIST
-	case BLKBEGIN: // Value is either map or set
-		for i = i + 1; i < n && text[i] != BLKEND; i++ {
-			// Handle cases ["Val \[2\]", "Val2" ]
-			if text[i] == ESCAPESEQ {
-				i++
-			}
-		}
-		paramVal.P_type = V_MAP_OR_SET
-	default:
-		// Numeric Case
-		if text[i] >= '0' && text[i] <= '9' {
-			j := strings.Index(text, COMMENT1)
-			if j < 0 {
-				j = strings.Index(text, COMMENT2)
-			}
-			if j < 0 {
-				j = strings.Index(text, " ")
-			}
-			if j > 0 {
-				wend = j
-			}
-			paramVal.P_type = V_NUMERIC
-		} else if text == "true" || text == "false" || strings.HasPrefix(text, "true") || strings.HasPrefix(text, "false") {
-			j := strings.Index(text, COMMENT1)
-			if j < 0 {
-				j = strings.Index(text, COMMENT2)
-			}
-			if j < 0 {
-				j = strings.Index(text, " ")
-			}
-			if j > 0 {
-				wend = j
-			} else {
-				j = n
-			}
-			if strings.TrimSpace(string(text[:j])) == "true" || strings.TrimSpace(string(text[:j])) == "false" {
-				paramVal.P_type = V_BOOLEAN
-			}
-		}
+func ValueType(value string) valueType {
+	if value == "" {
+		return V_SCALAR
 	}
-	// Value is suffixed with REPLACE-ME comment eg: foo = 5 // REPLACE-ME
-	if wend < n {
-		if strings.Contains(string(text[wend:n]), COMMENT1) || strings.Contains(string(text[wend:n]), COMMENT2) {
-			replaceEligible = strings.HasSuffix(string(text[i:n]), REPLACE)
+	// the value is one string, list or map if its first symbol is closed at the end
+	single := func(open byte) bool {
+		return value[0] == open && closingIndex(value) == len(value)-1
+	}
+	switch {
+	case value == "true" || value == "false":
+		return V_BOOLEAN
+	case value == "null":
+		return V_NULL
+	case strings.HasPrefix(value, HEREDOC):
+		if marker, _ := heredocMarker(value, 0); marker != "" && strings.TrimSpace(value[strings.LastIndex(value, "\n")+1:]) == marker {
+			return stringType(value)
 		}
+	case single(STRDELIM):
+		return stringType(value)
+	case single(LISTBEGIN):
+		return V_LIST
+	case single(BLKBEGIN):
+		return V_MAP_OR_SET
+	case (value[0] >= '0' && value[0] <= '9') || value[0] == '-':
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return V_NUMERIC
+		}
+	case isReference(value):
+		return V_REFERANCE
+	case isFunctionCall(value):
+		return V_FUNCTION
 	}
-	// Value is "REPLACE-ME"
-	if !replaceEligible && (string(text[wstart:wend]) == REPLACE2) {
-		replaceEligible = true
+	return V_SCALAR
+}
+
+// returns INTERPOLATION if the string has a template sequence, STRING otherwise
+func stringType(value string) valueType {
+	if strings.Contains(value, TEMPLATE1) || strings.Contains(value, TEMPLATE2) {
+		return V_INTERPOLATION
 	}
-	paramVal.P_value = strings.TrimSpace(string(text[wstart:wend]))
-	paramVal.P_replace = replaceEligible
-	return paramVal
+	return V_STRING
 }
 
 // Return new Parser object
@@ -326,9 +334,48 @@ func (tfp *TFParser) SetScanner(scanner *bufio.Scanner) {
 }
 
 /*
- * initializes the logger object
+ * Reads the next line from the scanner
+ */
+func (tfp *TFParser) next() (string, bool) {
+	if tfp.scan == nil || !tfp.scan.Scan() {
+		return "", false
+	}
+	tfp.line++
+	return tfp.scan.Text(), true
+}
+
+/*
+ * Adds an error at the line and column (both start from 1) of the input
+ */
+func (tfp *TFParser) errorf(line int, col int, snippet string, format string, args ...any) {
+	tfp.diags = append(tfp.diags, Diagnostic{
+		Severity: SEV_ERROR,
+		File:     tfp.name,
+		Line:     line,
+		Column:   col,
+		Message:  fmt.Sprintf(format, args...),
+		Snippet:  snippet,
+	})
+}
+
+/*
+ * Returns the problems found while parsing
+ */
+func (tfp *TFParser) Diagnostics() Diagnostics {
+	return tfp.diags
+}
+
+/*
+ * initializes the name of the input used in the diagnostics
+ */
+func (tfp *TFParser) SetName(name string) {
+	tfp.name = name
+}
+
+/*
+ * initializes the output of the render mode
  */
-func (tfp *TFParser) SetLoger(outfile *os.File) {
+func (tfp *TFParser) SetLoger(outfile io.Writer) {
 	tfp.file = outfile
 }
 
@@ -359,8 +406,13 @@ func (tfp *TFParser) ParseBlockType(itext string) (int, int) {
 		}
 		tfp.text += itext
 
-		for !strings.HasSuffix(strings.TrimSpace(itext), "*/") && tfp.scan.Scan() {
-			itext = tfp.scan.Text()
+		line, start := tfp.line, itext
+		for !strings.HasSuffix(strings.TrimSpace(itext), "*/") {
+			var ok bool
+			if itext, ok = tfp.next(); !ok {
+				tfp.errorf(line, strings.Index(start, "/*")+1, start, "comment is not closed")
+				break
+			}
 			tfp.text += "\n" + itext
 		}
 		return 11, n
@@ -396,17 +448,20 @@ func (tfp *TFParser) ParseBlockType(itext string) (int, int) {
  * Return:
  */
 func (tfp *TFParser) ProcessStream(parsedData *TFBlocks) int {
-	var i, s, nextpos, depth, iteration int
+	var i, s, nextpos, depth int
 	var tfbp *TFBlock
-
-	log.Printf("\nIn ProcessStream")
+	// position of the open blocks for the diagnostics
+	var opened []Diagnostic
 
 	mb := CreateModuleBlock()
 
 	// Parse the text for tokens and words
-	for tfp.scan.Scan() {
+	for {
+		text, ok := tfp.next()
+		if !ok {
+			break
+		}
 		nextpos = 0
-		text := tfp.scan.Text()
 		n := len(text)
 
 		// Process any comments or blank lines and store them
@@ -414,23 +469,21 @@ func (tfp *TFParser) ProcessStream(parsedData *TFBlocks) int {
 		if bidx >= 10 {
 			nextpos = n
 			if tfp.file != nil {
-				if iteration > 0 {
-					fmt.Fprintf(tfp.file, "\n")
-				}
-				fmt.Fprintf(tfp.file, "%s", tfp.text)
+				fmt.Fprintf(tfp.file, "%s\n", tfp.text)
 				tfp.text = ""
 			}
-		} else {
-			if tfp.file != nil && !strings.Contains(text, "=") {
-				if iteration > 0 {
-					fmt.Fprintf(tfp.file, "\n")
-				}
-				fmt.Fprintf(tfp.file, "%s", text)
-			}
 		}
+		// lines without assignment are rendered as is
+		line, assigned, pending := text, false, ""
+		// line holding the text and the column of the text in it, for the diagnostics
+		src, off := text, 0
 
 		// Process terraform blocks
 		for i = nextpos; i < n; i++ {
+			// rest of the line is a comment
+			if text[i] == COMMENT2[0] || strings.HasPrefix(text[i:], COMMENT1) {
+				break
+			}
 			switch text[i] {
 			case BLKBEGIN:
 				var parentName string
@@ -458,17 +511,21 @@ func (tfp *TFParser) ProcessStream(parsedData *TFBlocks) int {
 				tfbp.Prefix = tfp.text
 				tfp.text = ""
 
-				mb.blockName = text[s:i]
+				if depth == 0 {
+					mb = CreateModuleBlock()
+					mb.BlockName = bname
+				}
+				opened = append(opened, Diagnostic{Line: tfp.line, Column: off + i + 1, Message: bname, Snippet: src})
 				depth++
 				//log.Printf("\nBLKBEGIN: %s::%d", tfbp.BlockName, depth)
 
 			case BLKEND:
 
 				if depth < 1 { // invalid format
-					log.Printf("\nInvalid block end %s", text)
+					tfp.errorf(tfp.line, off+i+1, src, "unexpected '}', no block is open")
 					continue
 				}
-				parsedData.MList = append(parsedData.MList, mb)
+				opened = opened[:len(opened)-1]
 				//log.Printf("\nBLKEND: %s::%d", tfbp.BlockName, depth)
 
 				depth--
@@ -477,50 +534,84 @@ func (tfp *TFParser) ProcessStream(parsedData *TFBlocks) int {
 					tfbp = tfbp.Parent
 				} else if tfbp != nil {
 					parsedData.TFList = append(parsedData.TFList, *tfbp)
+					parsedData.MList = append(parsedData.MList, mb)
 				}
 
 			case BLKASSIGN:
 
 				if depth < 1 { // invalid format
-					log.Printf("\nInvalid = %s", text)
+					tfp.errorf(tfp.line, off+i+1, src, "assignment outside of a block")
+					i = n
 					continue
 				}
 
 				param := strings.TrimSpace(text[s:i])
+				if param == "" {
+					tfp.errorf(tfp.line, off+i+1, src, "name is missing before '='")
+				}
 				rhs := text[i+1 : n]
-				value := tfp.ParseValue(rhs)
+				// the rendered assignment keeps the spacing of the input
+				assign := text[s:i+1] + " "
+				if ws := len(rhs) - len(strings.TrimLeft(rhs, " \t")); ws > 0 {
+					assign = text[s : i+1+ws]
+				}
+				value := tfp.parseValue(rhs, src, off+i+1)
+				assigned = true
 
 				if value.P_value != "{" {
-					mb.params[param] = value
+					mb.Params[param] = value
 					tfbp.Params[param] = value
 					if value.P_replace {
+						key := tfbp.BlockfName + "." + param
+						if parsedData.KeyFunc != nil {
+							key = parsedData.KeyFunc(key)
+						}
+						parsedData.Schema[key] = value
 						if !parsedData.Skip {
-							parsedData.Param[tfbp.BlockfName+"."+param] = value
-						} else {
-							value.P_value = parsedData.Param[tfbp.BlockfName+"."+param].P_value
+							parsedData.Param[key] = value
+						} else if parsedData.VarRefs {
+							value.P_value = "var." + VarName(key)
+						} else if p, found := parsedData.Param[key]; found {
+							// keys without value keep the value of the template
+							value.P_value = p.P_value
 						}
-						log.Printf("\n\tkey: %s:%s=>%v", tfbp.BlockName, param, value)
 					}
 					if tfp.file != nil {
-						fmt.Fprintf(tfp.file, "\n%s = %s", text[s:i], value.P_value)
+						fmt.Fprintf(tfp.file, "%s%s", assign, value.P_value)
 					}
 
-					i = n
+					// continue with the text after the value (eg: the "}" of a single line block)
+					text = tfp.rest
+					src, off = tfp.restLine, tfp.restCol
+					n = len(text)
+					i = -1
+					pending = text
 				} else {
 					if tfp.file != nil {
-						fmt.Fprintf(tfp.file, "\n%s = %s", text[s:i], value.P_value)
+						fmt.Fprintf(tfp.file, "%s%s", assign, value.P_value)
 					}
+					pending = ""
 				}
 
 			default:
 			}
 		}
-		iteration++
+		if tfp.file != nil && bidx < 10 {
+			if assigned {
+				// text after the last assignment of the line
+				line = pending
+			}
+			fmt.Fprintf(tfp.file, "%s\n", line)
+		}
+	}
+
+	for _, o := range opened {
+		tfp.errorf(o.Line, o.Column, o.Snippet, "block %s is not closed", o.Message)
 	}
 	return 0
 }
 
-func (parcedBlock *TFBlock) Walk(level int, i int, ts int, file *os.File, tfbs *TFBlocks) int {
+func (parcedBlock *TFBlock) Walk(level int, i int, ts int, file io.Writer, tfbs *TFBlocks) int {
 
 	if i > 0 || level > 0 {
 		fmt.Fprintf(file, "\n")
@@ -564,10 +655,8 @@ func (parcedBlock *TFBlock) Walk(level int, i int, ts int, file *os.File, tfbs *
 	return 0
 }
 
-func (parcedBlocks *TFBlocks) Walk(level int, ts int, file *os.File) int {
+func (parcedBlocks *TFBlocks) Walk(level int, ts int, file io.Writer) int {
 	var i, n int
-
-	log.Printf("\nparcedBlocks In Walk")
 	n = len(parcedBlocks.TFList)
 
 	for i = 0; i < n; i++ {
@@ -581,52 +670,129 @@ func (parcedBlocks *TFBlocks) Walk(level int, ts int, file *os.File) int {
 }
 
 // Create and return TFBlocks object
-func CreateTFBlocks() {
+func CreateTFBlocks() TFBlocks {
 	tfbs := TFBlocks{}
 	tfbs.Init()
+	return tfbs
 }
 
 // Initiate the maps of a TFBlocks object
 func (tfbs *TFBlocks) Init() {
 	tfbs.Param = make(map[string]ParamValue)
+	tfbs.Schema = make(map[string]ParamValue)
+}
+
+/*
+ * Returns the terraform variable name for the config key
+ * eg: module "echo".foo => module_echo_foo
+ */
+func VarName(key string) string {
+	var sb strings.Builder
+	sep := false
+	for _, c := range strings.ToLower(key) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			if sep && sb.Len() > 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(c)
+			sep = false
+		} else {
+			sep = true
+		}
+	}
+	name := sb.String()
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "v_" + name
+	}
+	return name
+}
+
+/*
+ * Returns the name of the kind of the value type (string, number, bool, list or map)
+ * empty string if the kind is not known before terraform evaluates the value (eg: references)
+ */
+func TypeName(t valueType) string {
+	switch t {
+	case V_STRING, V_INTERPOLATION:
+		return "string"
+	case V_NUMERIC:
+		return "number"
+	case V_BOOLEAN:
+		return "bool"
+	case V_LIST:
+		return "list"
+	case V_MAP_OR_SET:
+		return "map"
+	}
+	return ""
+}
+
+/*
+ * Returns the terraform type of the variable inferred from the type of the value
+ */
+func VarType(t valueType) string {
+	switch name := TypeName(t); name {
+	case "list":
+		return "list(any)"
+	case "map", "":
+		// the values of an object may have different types (eg: { a = 1, b = [] }), map(any) rejects them
+		return "any"
+	default:
+		return name
+	}
 }
 
 /*
  * Takes file name and parses the stream and
  * constructs the Parsed Block structure along with the questions
  * Input: filename of the input tf module
+ * tfbp: optional blocks to fill, with Skip set the file is rendered to wfile with the values of tfbp.Param
  * Returns: constructed TFBlock structure
+ * error: Diagnostics with the position of each problem if the file has errors
  */
-func ParseTF(modfile string, tfbp *TFBlocks, wfile *os.File) (*TFBlocks, error) {
-	var tfbptr *TFBlocks
-
-	log.Println("In ParseTF")
+func ParseTF(modfile string, tfbp *TFBlocks, wfile io.Writer) (*TFBlocks, error) {
 	file, err := os.Open(modfile)
 	if err != nil {
-		log.Println("Failed to open file:", modfile)
-		log.Println("Error:", err)
 		return nil, err
 	}
 	defer file.Close()
+	return parseStream(file, modfile, tfbp, wfile)
+}
+
+// parses the input into tfbp (new blocks if nil) and writes the rendered text to wfile
+// the text is rendered to a buffer first, nothing is written to wfile if the input has errors
+func parseStream(r io.Reader, name string, tfbp *TFBlocks, wfile io.Writer) (*TFBlocks, error) {
+	var tfbptr *TFBlocks
+	var rendered bytes.Buffer
 
 	if tfbp == nil {
-		var tfb TFBlocks
-		tfb.Init()
+		tfb := CreateTFBlocks()
 		tfbptr = &tfb
 	} else {
 		tfbptr = tfbp
 	}
 
 	tfp := CreateTFParser()
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 
-	tfp.SetLoger(wfile)
+	if wfile != nil {
+		tfp.SetLoger(&rendered)
+	}
 	tfp.SetScanner(scanner)
+	tfp.SetName(name)
 
 	tfp.ProcessStream(tfbptr)
 
 	if err := scanner.Err(); err != nil {
 		return tfbptr, err
 	}
+	if diags := tfp.Diagnostics(); diags.HasErrors() {
+		return tfbptr, diags
+	}
+	if wfile != nil {
+		if _, err := rendered.WriteTo(wfile); err != nil {
+			return tfbptr, err
+		}
+	}
 	return tfbptr, nil
 }
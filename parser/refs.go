@@ -0,0 +1,265 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+)
+
+// first segments of the references that are not declared by a block
+var builtinRefs = map[string]bool{
+	"each":      true,
+	"count":     true,
+	"path":      true,
+	"terraform": true,
+	"self":      true,
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+/*
+ * Parses the traversal (eg: module.vpc.ids[0]) that starts at i
+ * Returns the names of the segments, index splats are skipped, and the index after the traversal
+ */
+func traversal(text string, i int) ([]string, int) {
+	var segs []string
+	n := len(text)
+	for {
+		j := i
+		for j < n && (isIdentByte(text[j]) || (j > i && text[j] == '-')) {
+			j++
+		}
+		segs = append(segs, text[i:j])
+		i = j
+		for i < n && text[i] == LISTBEGIN {
+			k := closingIndex(text[i:])
+			if k < 0 {
+				return segs, n
+			}
+			i += k + 1
+		}
+		if i+1 < n && text[i] == '.' && isIdentStart(text[i+1]) {
+			i++
+			continue
+		}
+		return segs, i
+	}
+}
+
+/*
+ * Returns the address of the block referenced by the traversal
+ * var.region => var.region, module.vpc.id => module.vpc, data.aws_ami.ubuntu.id => data.aws_ami.ubuntu
+ * aws_instance.web.id => aws_instance.web
+ * Returns empty string for builtin references (each, count, path etc) and for non references
+ */
+func address(segs []string) string {
+	if len(segs) < 2 || builtinRefs[segs[0]] {
+		return ""
+	}
+	switch segs[0] {
+	case "var", "local", "module":
+		return segs[0] + "." + segs[1]
+	case "data":
+		if len(segs) < 3 {
+			return ""
+		}
+		return "data." + segs[1] + "." + segs[2]
+	}
+	// resource types are prefixed with the provider name (aws_instance)
+	if strings.Contains(segs[0], "_") {
+		return segs[0] + "." + segs[1]
+	}
+	return ""
+}
+
+// returns the index after the quoted string that starts at i
+func stringEnd(text string, i int) int {
+	n := len(text)
+	for j := i + 1; j < n; j++ {
+		switch {
+		case text[j] == ESCAPESEQ:
+			j++
+		case strings.HasPrefix(text[j:], TEMPLATE1) || strings.HasPrefix(text[j:], TEMPLATE2):
+			k := closingIndex(text[j+1:])
+			if k < 0 {
+				return n
+			}
+			j += k + 1
+		case text[j] == STRDELIM:
+			return j + 1
+		}
+	}
+	return n
+}
+
+// collects the references of the interpolations ${ } and directives %{ } of the template text
+func templateRefs(text string, add func(string)) {
+	for i := 0; i < len(text); i++ {
+		if !strings.HasPrefix(text[i:], TEMPLATE1) && !strings.HasPrefix(text[i:], TEMPLATE2) {
+			continue
+		}
+		k := closingIndex(text[i+1:])
+		if k < 0 {
+			k = len(text) - i - 1
+		}
+		exprRefs(text[i+2:i+1+k], add)
+		i += k + 1
+	}
+}
+
+// collects the references of the expression text
+func exprRefs(text string, add func(string)) {
+	n := len(text)
+	for i := 0; i < n; {
+		c := text[i]
+		switch {
+		case c == STRDELIM:
+			j := stringEnd(text, i)
+			templateRefs(text[i+1:j], add)
+			i = j
+		case strings.HasPrefix(text[i:], HEREDOC):
+			marker, k := heredocMarker(text, i)
+			if marker == "" {
+				i += len(HEREDOC)
+				continue
+			}
+			// body starts on the next line and ends with the line holding only the marker
+			body := ""
+			end := n
+			if nl := strings.IndexByte(text[k:], '\n'); nl >= 0 {
+				start := k + nl + 1
+				end = start
+				for end < n {
+					lineEnd := strings.IndexByte(text[end:], '\n')
+					if lineEnd < 0 {
+						lineEnd = n - end
+					}
+					if strings.TrimSpace(text[end:end+lineEnd]) == marker {
+						break
+					}
+					end += lineEnd + 1
+				}
+				body = text[start:min(end, n)]
+			}
+			templateRefs(body, add)
+			i = end
+		case c == COMMENT2[0] || strings.HasPrefix(text[i:], COMMENT1):
+			if nl := strings.IndexByte(text[i:], '\n'); nl >= 0 {
+				i += nl
+			} else {
+				i = n
+			}
+		case strings.HasPrefix(text[i:], COMMENT3):
+			if k := strings.Index(text[i:], COMMENTEND); k >= 0 {
+				i += k + len(COMMENTEND)
+			} else {
+				i = n
+			}
+		case isIdentStart(c) && (i == 0 || (text[i-1] != '.' && !isIdentByte(text[i-1]))):
+			segs, j := traversal(text, i)
+			rest := strings.TrimLeft(text[j:], " \t")
+			// function names are not references
+			if !strings.HasPrefix(rest, string(PARENBEGIN)) {
+				if addr := address(segs); addr != "" {
+					add(addr)
+				}
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+}
+
+/*
+ * Returns the addresses of the blocks referenced by the expression, sorted and without duplicates
+ * eg: "${var.env}-${module.vpc.id}" => [module.vpc var.env]
+ */
+func References(expr string) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	exprRefs(expr, func(addr string) {
+		if !seen[addr] {
+			seen[addr] = true
+			refs = append(refs, addr)
+		}
+	})
+	sort.Strings(refs)
+	return refs
+}
+
+/*
+ * Returns true if the value is a single reference like var.region or module.vpc.ids[0]
+ */
+func isReference(value string) bool {
+	if value == "" || !isIdentStart(value[0]) {
+		return false
+	}
+	segs, j := traversal(value, 0)
+	return j == len(value) && len(segs) > 1
+}
+
+/*
+ * Returns true if the value is a single function call like merge(local.tags, {})
+ */
+func isFunctionCall(value string) bool {
+	if value == "" || !isIdentStart(value[0]) {
+		return false
+	}
+	j := 0
+	for j < len(value) && (isIdentByte(value[j]) || value[j] == ':') {
+		j++
+	}
+	if j == len(value) || value[j] != PARENBEGIN {
+		return false
+	}
+	return j+closingIndex(value[j:]) == len(value)-1
+}
+
+/*
+ * Returns the addresses declared by the blocks (var.<name>, local.<name>, module.<name>,
+ * data.<type>.<name> and <type>.<name> of the resources)
+ */
+func (tfbs *TFBlocks) Addresses() map[string]bool {
+	declared := make(map[string]bool)
+	for i := range tfbs.TFList {
+		b := &tfbs.TFList[i]
+		fields := strings.Fields(b.BlockName)
+		for j := range fields {
+			fields[j] = strings.Trim(fields[j], "\"")
+		}
+		switch {
+		case len(fields) == 1 && fields[0] == "locals":
+			for k := range b.Params {
+				declared["local."+k] = true
+			}
+			for _, c := range b.Child {
+				declared["local."+c.BlockName] = true
+			}
+		case len(fields) == 2 && fields[0] == "variable":
+			declared["var."+fields[1]] = true
+		case len(fields) == 2 && fields[0] == "module":
+			declared["module."+fields[1]] = true
+		case len(fields) == 3 && fields[0] == "data":
+			declared["data."+fields[1]+"."+fields[2]] = true
+		case len(fields) == 3 && fields[0] == "resource":
+			declared[fields[1]+"."+fields[2]] = true
+		}
+	}
+	return declared
+}
+
+/*
+ * Returns the references of the value that are not declared by the blocks
+ */
+func (tfbs *TFBlocks) Undeclared(value string) []string {
+	var missing []string
+	declared := tfbs.Addresses()
+	for _, ref := range References(value) {
+		if !declared[ref] {
+			missing = append(missing, ref)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,10 @@
+module "app" {
+    source = "../"
+    name = "app" // REPLACE-ME
+    instance_type = "t3.micro" // REPLACE-ME env
+    replicas = 1 # REPLACE-ME env
+    tags = { // REPLACE-ME env
+        tier = "web"
+    }
+    domain = "REPLACE-ME" // REPLACE-ME env
+}
@@ -0,0 +1,26 @@
+variable "env" {
+    type = string
+}
+
+locals {
+    prefix = "app"
+}
+
+resource "aws_vpc" "main" {
+    cidr_block = "10.0.0.0/16" // REPLACE-ME
+}
+
+module "net" {
+    source = "./net"
+    vpc_id = aws_vpc.main.id // REPLACE-ME
+    name = "${local.prefix}-${var.env}" // REPLACE-ME
+    tags = merge(local.tags, { env = var.env }) // REPLACE-ME
+    subnets = [for s in var.subnets : s.id] // REPLACE-ME
+    enabled = true // REPLACE-ME
+    count_max = 3 // REPLACE-ME
+    ratio = -1.5 // REPLACE-ME
+    owner = null // REPLACE-ME
+    region = "REPLACE-ME"
+    ami = data.aws_ami.ubuntu.id // REPLACE-ME
+    zone = var.zone
+}
@@ -0,0 +1,28 @@
+variable "size" { default = 1 }
+
+module "app" {
+    source = "./app"
+    # map value
+    labels = { // REPLACE-ME
+        app  = "echo"
+        tier = "web"
+    }
+    script = <<-EOT // REPLACE-ME
+      #!/bin/bash
+      echo "hello"
+    EOT
+    rules = [
+        {
+            port = 80
+            cidr = ["0.0.0.0/0"]
+        },
+        { port = 443, cidr = [] },
+    ] // REPLACE-ME
+    name = format("%s-%s",
+        "app",
+        "dev") // REPLACE-ME
+    settings = {
+        retries = 3 // REPLACE-ME
+        timeout = 30
+    }
+}
@@ -0,0 +1,34 @@
+package parser_test
+
+import (
+	"testing"
+	"vdex/parser"
+)
+
+func TestVarType(t *testing.T) {
+	tests := []struct {
+		value    string
+		typeName string
+		varType  string
+	}{
+		{`"eu-west-1"`, "string", "string"},
+		{`"${var.env}-app"`, "string", "string"},
+		{`5`, "number", "number"},
+		{`true`, "bool", "bool"},
+		{`["a", "b"]`, "list", "list(any)"},
+		{`{ a = "x", b = "y" }`, "map", "any"},
+		{`{ a = 1, b = "x", c = [] }`, "map", "any"},
+		{`var.region`, "", "any"},
+		{`merge(local.tags, {})`, "", "any"},
+		{`null`, "", "any"},
+	}
+	for _, tt := range tests {
+		vt := parser.ValueType(tt.value)
+		if got := parser.TypeName(vt); got != tt.typeName {
+			t.Errorf("TypeName(%s) = %q, want %q", tt.value, got, tt.typeName)
+		}
+		if got := parser.VarType(vt); got != tt.varType {
+			t.Errorf("VarType(%s) = %q, want %q", tt.value, got, tt.varType)
+		}
+	}
+}
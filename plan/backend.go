@@ -0,0 +1,142 @@
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"vdex/codec"
+	cfg "vdex/config"
+	"vdex/parser"
+)
+
+// generated file setting the backend type of the project, terraform merges it over the backend block of the template
+const BACKEND_OVERRIDE_FILE = "backend_override.tf"
+
+// file in the .terraform folder of a system recording the backend config terraform was last initialized with
+const BACKEND_INIT_FILE = "vdex-backend"
+
+/*
+ * Returns the arguments of terraform init passing the backend config of the project for the system and environment
+ * the .cache folder of a system is shared by its environments, -reconfigure lets terraform take the backend
+ * config of the environment instead of asking to migrate the state of the previous one
+ */
+func backendInitArgs(config *cfg.Config, system string, myenv string) []string {
+	settings := config.BackendSettings(system, myenv)
+	if len(settings) == 0 {
+		return nil
+	}
+	args := []string{"-reconfigure"}
+	for _, k := range codec.SortKeys(settings) {
+		args = append(args, fmt.Sprintf("-backend-config=%s=%s", k, settings[k]))
+	}
+	return args
+}
+
+// returns the file recording the backend config the folder tfPath was last initialized with
+func backendInitFile(tfPath string) string {
+	return filepath.Join(tfPath, ".terraform", BACKEND_INIT_FILE)
+}
+
+/*
+ * Runs terraform init with the backend config of the project for the system and environment
+ * the backend config is recorded, a later run of an environment with another backend config initializes again
+ * Returns the output of terraform init
+ */
+func initBackend(config *cfg.Config, tf Terraform, system string, myenv string) ([]byte, error) {
+	args := backendInitArgs(config, system, myenv)
+	out, err := tf.Run(append([]string{"init"}, args...)...)
+	if err != nil {
+		return out, err
+	}
+	if err := os.WriteFile(backendInitFile(tf.Dir), []byte(strings.Join(args, "\n")+"\n"), 0644); err != nil {
+		log.Println("Failed to record the backend config of", tf.Dir, err)
+	}
+	return out, nil
+}
+
+/*
+ * Returns true if the folder tfPath is initialized with the backend config of the environment,
+ * or if there is nothing to initialize (no backend config or the folder is not initialized yet)
+ */
+func backendSelected(config *cfg.Config, tfPath string, system string, myenv string) bool {
+	args := backendInitArgs(config, system, myenv)
+	if len(args) == 0 {
+		return true
+	}
+	if _, err := os.Stat(filepath.Join(tfPath, ".terraform")); err != nil {
+		return true
+	}
+	data, err := os.ReadFile(backendInitFile(tfPath))
+	return err == nil && string(data) == strings.Join(args, "\n")+"\n"
+}
+
+/*
+ * Initializes the folder tfPath again if it was last initialized with the backend config of another environment,
+ * so terraform reads the state of the environment (eg: terraform output after a plan of another environment)
+ * nothing is done if the project sets no backend config or the folder is not initialized yet
+ * the default workspace is used for the init, the workspace of the environment may not exist in its backend yet
+ */
+func SelectBackend(config *cfg.Config, tfPath string, system string, myenv string) error {
+	if backendSelected(config, tfPath, system, myenv) {
+		return nil
+	}
+	log.Println("Initializing", tfPath, "with the backend config of", system, myenv)
+	tf := NewTerraform(tfPath, "TF_WORKSPACE="+cfg.WORKSPACE_DEF, "TF_IN_AUTOMATION=1")
+	if _, err := initBackend(config, tf, system, myenv); err != nil {
+		return fmt.Errorf("terraform init with the backend of environment %s failed: %w", myenv, err)
+	}
+	return nil
+}
+
+/*
+ * Writes backend_override.tf into the folder mainPath if the project sets the backend type
+ * the file of an earlier render is removed otherwise
+ * Returns
+ * the generated file, empty if the project sets no backend type
+ * error: if any failure
+ */
+func writeBackendOverride(config *cfg.Config, mainPath string) (string, error) {
+	file := path.Join(mainPath, BACKEND_OVERRIDE_FILE)
+	if config.Backend == "" {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Println("Failed to remove", file, err)
+		}
+		return "", nil
+	}
+	content, err := backendOverride(config, file)
+	if err != nil {
+		log.Println("Failed to generate", file, err)
+		return "", err
+	}
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		log.Println("Failed to write", file, err)
+		return "", err
+	}
+	return file, nil
+}
+
+// returns the content of backend_override.tf, indented with the tab size like the generated templates
+// the settings are passed to terraform init, the block only selects the backend
+func backendOverride(config *cfg.Config, file string) ([]byte, error) {
+	indent := strings.Repeat(" ", config.Tabsize)
+	var sb strings.Builder
+	sb.WriteString("# generated by vdex from the backend of the project config")
+	sb.WriteString("\nterraform {")
+	fmt.Fprintf(&sb, "\n%sbackend %q {}", indent, config.Backend)
+	sb.WriteString("\n}\n")
+
+	// the block is rendered like the files of the template, a backend type breaking it is reported with its position
+	doc, err := parser.Parse(strings.NewReader(sb.String()), file)
+	if err != nil {
+		return nil, err
+	}
+	var rendered bytes.Buffer
+	if err := parser.Render(doc, nil, &rendered); err != nil {
+		return nil, err
+	}
+	return rendered.Bytes(), nil
+}
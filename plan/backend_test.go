@@ -0,0 +1,46 @@
+package plan
+
+import (
+	"os"
+	"path"
+	"testing"
+	cfg "vdex/config"
+)
+
+func TestWriteBackendOverride(t *testing.T) {
+	tests := []struct {
+		backend string
+		tabsize int
+		want    string
+	}{
+		{"s3", 4, "# generated by vdex from the backend of the project config\nterraform {\n    backend \"s3\" {}\n}\n"},
+		{"azurerm", 2, "# generated by vdex from the backend of the project config\nterraform {\n  backend \"azurerm\" {}\n}\n"},
+		{"", 4, ""},
+	}
+	for _, tt := range tests {
+		mainPath := t.TempDir()
+		config := cfg.NewConfig()
+		config.Backend = tt.backend
+		config.Tabsize = tt.tabsize
+		file := path.Join(mainPath, BACKEND_OVERRIDE_FILE)
+		// the file of an earlier render
+		if err := os.WriteFile(file, []byte("terraform {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := writeBackendOverride(&config, mainPath)
+		if err != nil {
+			t.Fatalf("writeBackendOverride(%s) error = %v", tt.backend, err)
+		}
+		data, readErr := os.ReadFile(file)
+		if tt.want == "" {
+			if got != "" || !os.IsNotExist(readErr) {
+				t.Errorf("writeBackendOverride() = %q, the file of the earlier render is kept", got)
+			}
+			continue
+		}
+		if got != file || string(data) != tt.want {
+			t.Errorf("writeBackendOverride(%s) = %s\n%s\nwant\n%s", tt.backend, got, data, tt.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	cfg "vdex/config"
+	"vdex/diff"
+)
+
+// Status of a generated file in the difference
+const (
+	FILE_ADDED    = "added"
+	FILE_DELETED  = "deleted"
+	FILE_MODIFIED = "modified"
+)
+
+// structure holds the changes of a generated file
+type FileChange struct {
+	// name of the system
+	System string `json:"system"`
+	// environment of the config
+	Env string `json:"env"`
+	// name of the file in the system folder (eg: main.tf)
+	File string `json:"file"`
+	// added, deleted or modified
+	Status string `json:"status"`
+	// number of inserted lines
+	Added int `json:"added"`
+	// number of deleted lines
+	Removed int `json:"removed"`
+	// changed lines
+	Lines []LineChange `json:"lines"`
+	// unified diff of the file
+	Unified string `json:"-"`
+}
+
+// structure holds a changed line
+type LineChange struct {
+	// + for an inserted line, - for a deleted line
+	Op string `json:"op"`
+	// line number in the new file for an insert, in the old file for a delete
+	Line int `json:"line"`
+	// text of the line
+	Text string `json:"text"`
+}
+
+/*
+ * Renders the config of the environment and compares it with the generated files of the .cache
+ * folder, or with the config at the git ref against when set
+ * system: compares only the named system if set
+ * color: colors the unified diff, asJSON: writes the changes as json instead of the unified diff
+ * Returns
+ * list of the changed files
+ * error: if any failure
+ */
+func VdexDiff(config *cfg.Config, myenv string, system string, against string, color bool, asJSON bool, w io.Writer) ([]FileChange, error) {
+	log.Printf("\nIn VdexDiff")
+
+	if err := checkSystem(config, system); err != nil {
+		return nil, err
+	}
+	if against != "" {
+		if err := gitVerify(against); err != nil {
+			return nil, err
+		}
+	}
+	systems, err := systemConfigs(config, myenv, system)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "vdex-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	changes := []FileChange{}
+	for _, sc := range systems {
+		newDir := filepath.Join(tmpDir, "new", sc.Name)
+		newFiles, err := RenderConfigFile(config, sc.Path, sc.File, newDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sc.File, err)
+		}
+		names := relNames(newDir, newFiles)
+
+		oldDir := filepath.Join(sc.Path, config.CachePath)
+		oldLabel := filepath.ToSlash(oldDir) + "/"
+		if against != "" {
+			oldDir = filepath.Join(tmpDir, "old", sc.Name)
+			oldLabel = against + ":" + sc.Name + "/"
+			oldFiles, err := renderAtRef(config, sc, against, filepath.Join(tmpDir, "config", sc.Name), oldDir)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, relNames(oldDir, oldFiles)...)
+		}
+
+		sort.Strings(names)
+		for i, name := range names {
+			if i > 0 && names[i-1] == name {
+				continue
+			}
+			oldText, oldFound := readText(filepath.Join(oldDir, name))
+			newText, newFound := readText(filepath.Join(newDir, name))
+			fc := compareFile(oldText, newText, oldLabel+name, sc.Name+"/"+name)
+			if fc == nil {
+				continue
+			}
+			fc.System, fc.Env, fc.File = sc.Name, myenv, name
+			if !oldFound {
+				fc.Status = FILE_ADDED
+			} else if !newFound {
+				fc.Status = FILE_DELETED
+			}
+			changes = append(changes, *fc)
+		}
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return changes, err
+	}
+	for _, fc := range changes {
+		fmt.Fprintf(w, "# %s (%s): %s %s, +%d -%d\n", fc.System, fc.Env, fc.File, fc.Status, fc.Added, fc.Removed)
+		if color {
+			io.WriteString(w, diff.Colorize(fc.Unified))
+		} else {
+			io.WriteString(w, fc.Unified)
+		}
+	}
+	return changes, nil
+}
+
+/*
+ * Returns the changes of the old and new text of a file, nil if both are same
+ */
+func compareFile(oldText string, newText string, oldName string, newName string) *FileChange {
+	lines := diff.Lines(oldText, newText)
+	if !diff.Changed(lines) {
+		return nil
+	}
+	fc := &FileChange{Status: FILE_MODIFIED, Lines: []LineChange{}}
+	for _, l := range lines {
+		switch l.Op {
+		case diff.INSERT:
+			fc.Added++
+			fc.Lines = append(fc.Lines, LineChange{Op: "+", Line: l.NewLine, Text: l.Text})
+		case diff.DELETE:
+			fc.Removed++
+			fc.Lines = append(fc.Lines, LineChange{Op: "-", Line: l.OldLine, Text: l.Text})
+		}
+	}
+	fc.Unified = diff.Unified(oldName, newName, oldText, newText, 3)
+	return fc
+}
+
+/*
+ * Renders the config file of the system as it is at the git ref into mainPath
+ * cfgDir is the folder the config file of the ref is written to
+ * Returns the generated files, none if the config file does not exist at the ref
+ */
+func renderAtRef(config *cfg.Config, sc systemConfig, ref string, cfgDir string, mainPath string) ([]string, error) {
+	data, found, err := gitShow(ref, sc.File)
+	if err != nil || !found {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfgDir, 0755); err != nil {
+		return nil, err
+	}
+	// the name is kept, the format and the environment are taken from it
+	cfgFile := filepath.Join(cfgDir, filepath.Base(sc.File))
+	if err := os.WriteFile(cfgFile, data, 0644); err != nil {
+		return nil, err
+	}
+	files, err := RenderConfigFile(config, sc.Path, cfgFile, mainPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s at %s: %w", sc.File, ref, err)
+	}
+	return files, nil
+}
+
+/*
+ * Returns error if the git ref is not a commit of the repository
+ */
+func gitVerify(ref string) error {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s is not a git commit of the current repository", ref)
+	}
+	return nil
+}
+
+/*
+ * Returns the content of the file at the git ref, found is false if the file does not exist at the ref
+ */
+func gitShow(ref string, file string) ([]byte, bool, error) {
+	spec := ref + ":./" + filepath.ToSlash(file)
+	if err := exec.Command("git", "cat-file", "-e", spec).Run(); err != nil {
+		log.Println("File not found at", spec)
+		return nil, false, nil
+	}
+	var stderr strings.Builder
+	cmd := exec.Command("git", "show", spec)
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, false, fmt.Errorf("git show %s failed: %s", spec, strings.TrimSpace(stderr.String()))
+	}
+	return data, true, nil
+}
+
+// returns the names of the files relative to the folder
+func relNames(dir string, files []string) []string {
+	var names []string
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			continue
+		}
+		names = append(names, filepath.ToSlash(rel))
+	}
+	return names
+}
+
+// returns the content of the file, found is false if it can not be read
+func readText(file string) (string, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
@@ -0,0 +1,116 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"vdex/codec"
+	cfg "vdex/config"
+	"vdex/graph"
+	"vdex/template"
+)
+
+// Formats of vdex graph
+const (
+	GRAPH_DOT     = "dot"
+	GRAPH_MERMAID = "mermaid"
+)
+
+/*
+ * Returns the systems the system is planned and applied after, as set by depends_on
+ * in the config or in the .vdex file of the system folder (eg: depends_on = ["iam", "network"])
+ */
+func DependsOn(teamCfgPath string, values map[string]string) []string {
+	value := strings.TrimSpace(template.SystemSetting(teamCfgPath, values, cfg.DEPENDS_ON_KEY))
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	var systems []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.Trim(strings.TrimSpace(s), "\"'"); s != "" {
+			systems = append(systems, s)
+		}
+	}
+	return systems
+}
+
+/*
+ * Returns the dependency graph of the systems, a system depends on the systems listed by its
+ * depends_on setting and on the systems its config values reference
+ * Returns an error if a system it depends on is not one of the systems
+ */
+func systemGraph(systems []systemConfig, myenv string) (*graph.Graph, error) {
+	g := graph.New()
+	names := make(map[string]bool, len(systems))
+	for _, sc := range systems {
+		names[sc.Name] = true
+	}
+	for _, sc := range systems {
+		values, err := codec.ReadFile(sc.File)
+		if err != nil {
+			// the error is reported when the system is rendered
+			log.Println("Failed to read config file:", sc.File, err)
+		}
+		refs := SystemRefs(values)
+		for _, r := range refs {
+			if !names[r] {
+				return nil, fmt.Errorf("%s references system %s which has no config for environment %s", sc.File, r, myenv)
+			}
+		}
+		deps := DependsOn(sc.Path, values)
+		for _, d := range deps {
+			if !names[d] {
+				return nil, fmt.Errorf("%s: %s lists system %s which has no config for environment %s", sc.File, cfg.DEPENDS_ON_KEY, d, myenv)
+			}
+		}
+		g.Add(sc.Name, append(refs, deps...)...)
+	}
+	return g, nil
+}
+
+/*
+ * Orders the systems so that each system comes after the systems it depends on
+ * Returns an error if a system it depends on has no config for the environment or the dependencies have a cycle
+ */
+func orderSystems(systems []systemConfig, myenv string) ([]systemConfig, error) {
+	g, err := systemGraph(systems, myenv)
+	if err != nil {
+		return nil, err
+	}
+	order, err := g.Order()
+	if err != nil {
+		return nil, fmt.Errorf("system dependencies of environment %s: %w", myenv, err)
+	}
+	byName := make(map[string]systemConfig, len(systems))
+	for _, sc := range systems {
+		byName[sc.Name] = sc
+	}
+	ordered := make([]systemConfig, 0, len(order))
+	for _, name := range order {
+		ordered = append(ordered, byName[name])
+	}
+	return ordered, nil
+}
+
+/*
+ * Writes the dependency graph of the systems having a config for the environment
+ * format: dot (graphviz) or mermaid
+ */
+func VdexGraph(config *cfg.Config, myenv string, format string, w io.Writer) error {
+	log.Printf("\nIn VdexGraph")
+
+	if format != GRAPH_DOT && format != GRAPH_MERMAID {
+		return fmt.Errorf("invalid graph format %q, use %s or %s", format, GRAPH_DOT, GRAPH_MERMAID)
+	}
+	systems, err := systemConfigs(config, myenv, "")
+	if err != nil {
+		return err
+	}
+	g, err := systemGraph(systems, myenv)
+	if err != nil {
+		return err
+	}
+	if format == GRAPH_MERMAID {
+		return g.WriteMermaid(w)
+	}
+	return g.WriteDot(w, "vdex-"+myenv)
+}
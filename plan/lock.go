@@ -0,0 +1,88 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"vdex/codec"
+	cfg "vdex/config"
+	"vdex/lock"
+)
+
+/*
+ * Locks the systems of the environment for the command, no other vdex process operates on them until they are unlocked
+ * the lock is per system, the runs of the other environments wait for it too as they share the .cache folder
+ * myenv: locks the systems having a config file of the environment, all the systems if empty
+ * system: locks only the named system if set
+ * Returns
+ * the function releasing the locks
+ * error: *lock.LockedError if a system is locked by another run, none of the systems is locked then
+ */
+func LockSystems(config *cfg.Config, myenv string, system string, command string) (func(), error) {
+	names := []string{system}
+	if system == "" {
+		entries, err := os.ReadDir(config.ConfPath)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		names = nil
+		for _, v := range entries {
+			if v.IsDir() && (myenv == "" || codec.Locate(path.Join(config.ConfPath, v.Name(), config.GetConfFile(myenv))) != "") {
+				names = append(names, v.Name())
+			}
+		}
+	}
+
+	var held []*lock.Lock
+	unlock := func() {
+		for _, l := range held {
+			if err := l.Release(); err != nil {
+				log.Println("Failed to release the lock", l.File, err)
+			}
+		}
+	}
+	for _, name := range names {
+		l, err := lock.Acquire(config, name, myenv, command)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		log.Println("Locked", name, "for", command, myenv, "in", l.File)
+		held = append(held, l)
+	}
+	return unlock, nil
+}
+
+/*
+ * Removes the lock of the system after confirmation, for the locks left by runs that were killed
+ * Returns true if the lock is removed
+ */
+func VdexUnlock(config *cfg.Config, system string, confirm func(string) bool, out io.Writer) (bool, error) {
+	log.Printf("\nIn VdexUnlock")
+
+	if err := checkSystem(config, system); err != nil {
+		return false, err
+	}
+	l, err := lock.Read(config, system)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(out, "%s is not locked\n", system)
+		return false, nil
+	} else if err != nil {
+		// a lock file that can not be read is removed as well
+		fmt.Fprintln(out, err)
+		l = &lock.Lock{System: system}
+	} else {
+		fmt.Fprintln(out, l)
+	}
+	if !confirm(fmt.Sprintf("Remove the lock of %s? Make sure the run holding it is no longer running", l.System)) {
+		return false, nil
+	}
+	if err := lock.Remove(config, system); err != nil {
+		return false, err
+	}
+	return true, nil
+}
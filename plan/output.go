@@ -0,0 +1,181 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"vdex/codec"
+	cfg "vdex/config"
+	"vdex/output"
+)
+
+// suffix of the file holding the outputs of a system (eg: src/sys1/dev-outputs.json)
+const OUTPUTS_SUFFIX = "-outputs.json"
+
+// output of terraform output -json
+type Output struct {
+	// true if terraform hides the value in its messages
+	Sensitive bool `json:"sensitive" yaml:"sensitive"`
+	// terraform type of the value
+	Type any `json:"type" yaml:"type"`
+	// value of the output
+	Value any `json:"value" yaml:"value"`
+	// true if the value of the sensitive output is left out of the file written by vdex output --write
+	Redacted bool `json:"redacted,omitempty" yaml:"redacted,omitempty"`
+}
+
+// outputs of the systems by system, environment and output name
+type Outputs map[string]map[string]map[string]Output
+
+/*
+ * Returns the file holding the outputs of the system and environment (eg: src/sys1/dev-outputs.json)
+ */
+func OutputsFile(config *cfg.Config, system string, myenv string) string {
+	return filepath.Join(config.ConfPath, system, myenv+OUTPUTS_SUFFIX)
+}
+
+/*
+ * Reads the outputs of the system and environment written by vdex output --write
+ */
+func ReadOutputs(config *cfg.Config, system string, myenv string) (map[string]Output, error) {
+	data, err := os.ReadFile(OutputsFile(config, system, myenv))
+	if err != nil {
+		return nil, err
+	}
+	outputs := make(map[string]Output)
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, fmt.Errorf("%s: %w", OutputsFile(config, system, myenv), err)
+	}
+	return outputs, nil
+}
+
+/*
+ * Returns the terraform outputs of the system in the workspace and the backend of its config
+ * reinit: terraform is initialized again if the .cache folder has the backend of another environment,
+ * otherwise an error is returned (the system may not be locked by the run)
+ */
+func systemOutputs(config *cfg.Config, sc systemConfig, reinit bool) (map[string]Output, error) {
+	mainPath := filepath.Join(sc.Path, config.CachePath)
+	if _, err := os.Stat(filepath.Join(mainPath, ".terraform")); err != nil {
+		return nil, fmt.Errorf("%s is not initialized, run vdex plan or apply first", mainPath)
+	}
+	myenv := cfg.GetEnvFromConfFile(codec.Base(filepath.Base(sc.File)))
+	if !reinit && !backendSelected(config, mainPath, sc.Name, myenv) {
+		return nil, fmt.Errorf("%s is initialized with the backend of another environment", mainPath)
+	} else if err := SelectBackend(config, mainPath, sc.Name, myenv); err != nil {
+		return nil, err
+	}
+	tf := NewTerraform(mainPath, "TF_WORKSPACE="+GetConfigWorkspace(sc.File), "TF_IN_AUTOMATION=1")
+	out, err := tf.Run("output", "-json", "-no-color")
+	if err != nil {
+		return nil, err
+	}
+	outputs := make(map[string]Output)
+	if err := json.Unmarshal(out, &outputs); err != nil {
+		return nil, fmt.Errorf("failed to read the output of terraform output in %s: %w", mainPath, err)
+	}
+	return outputs, nil
+}
+
+/*
+ * Collects the terraform outputs of the systems of the environment
+ * terraform output -json runs in the .cache folder of each system with the workspace of its config
+ * system: collects only the named system if set
+ * write: the outputs of each system are written to src/<system>/<env>-outputs.json, without the values of the sensitive outputs
+ * Returns
+ * the outputs by system and environment
+ * error: if the outputs of any system could not be collected
+ */
+func VdexOutput(config *cfg.Config, myenv string, system string, write bool, out io.Writer) (Outputs, error) {
+	log.Printf("\nIn VdexOutput")
+
+	if err := checkSystem(config, system); err != nil {
+		return nil, err
+	}
+	systems, err := systemConfigs(config, myenv, system)
+	if err != nil {
+		return nil, err
+	}
+
+	collected := Outputs{}
+	var failed error
+	for _, sc := range systems {
+		outputs, err := systemOutputs(config, sc, true)
+		if err != nil {
+			log.Println("Failed to collect the outputs of", sc.Name, err)
+			fmt.Fprintln(out, "Failed to collect the outputs of", sc.Name, ":", err)
+			failed = err
+			continue
+		}
+		collected[sc.Name] = map[string]map[string]Output{myenv: outputs}
+		if !write {
+			continue
+		}
+		data, err := json.MarshalIndent(redactOutputs(outputs), "", "  ")
+		if err != nil {
+			return collected, err
+		}
+		file := OutputsFile(config, sc.Name, myenv)
+		if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+			return collected, err
+		}
+		fmt.Fprintln(out, "Outputs of", sc.Name, "are saved in", file)
+	}
+	if len(systems) == 0 {
+		fmt.Fprintln(out, "No config file is found for environment", myenv)
+	}
+	return collected, failed
+}
+
+/*
+ * Returns a copy of the outputs with the values of the sensitive outputs removed, the file written by
+ * vdex output --write is kept in the system folder that is usually in git
+ */
+func redactOutputs(outputs map[string]Output) map[string]Output {
+	redacted := make(map[string]Output, len(outputs))
+	for name, o := range outputs {
+		if o.Sensitive {
+			o.Value, o.Redacted = nil, true
+		}
+		redacted[name] = o
+	}
+	return redacted
+}
+
+/*
+ * Writes the outputs in the format (table, json or yaml), the values of sensitive outputs are hidden in the table
+ */
+func WriteOutputs(w io.Writer, format string, outputs Outputs) error {
+	if format != output.FORMAT_TABLE {
+		return output.Write(w, format, outputs)
+	}
+	table := output.NewTable("system-name", "environment", "output", "value")
+	for _, system := range codec.SortKeys(outputs) {
+		for _, env := range codec.SortKeys(outputs[system]) {
+			for _, name := range codec.SortKeys(outputs[system][env]) {
+				o := outputs[system][env][name]
+				value := "(sensitive)"
+				if !o.Sensitive {
+					value = outputText(o.Value)
+				}
+				table.Add(system, env, name, value)
+			}
+		}
+	}
+	return table.Write(w)
+}
+
+// returns the value as shown in the table, strings without quotes and others as json
+func outputText(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -1,302 +1,544 @@
 package plan
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
-	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"time"
+	"vdex/codec"
 	cfg "vdex/config"
-	parcer "vdex/parser"
+	"vdex/history"
+	"vdex/parser"
+	"vdex/snapshot"
+	"vdex/template"
 )
 
-func ReadConfigFile(config *cfg.Config, teamCfgPath string, teamCfgFile string) (string, error) {
-	var parcedBlocks parcer.TFBlocks
-	parcedBlocks.Init()
+/*
+ * Reads the config file and renders the template into the .cache folder of the system
+ * the template is rendered into a staging folder which then takes the place of the .cache folder
+ * Returns
+ * list of the generated files
+ * error: if any failure
+ */
+func ReadConfigFile(config *cfg.Config, teamCfgPath string, teamCfgFile string) ([]string, error) {
+	return renderStaged(config, teamCfgPath, func(stagePath string) ([]string, error) {
+		return RenderConfigFile(config, teamCfgPath, teamCfgFile, stagePath)
+	})
+}
 
-	log.Printf("\nIn ReadConfigFile %s", teamCfgFile)
+/*
+ * Reads the config file and renders the template into the folder mainPath
+ * Returns
+ * list of the generated files
+ * error: if any failure
+ */
+func RenderConfigFile(config *cfg.Config, teamCfgPath string, teamCfgFile string, mainPath string) ([]string, error) {
+	log.Printf("\nIn RenderConfigFile %s", teamCfgFile)
 
 	// Read the user configuration file into userConfig
-	var userConfig map[string]string = make(map[string]string)
-
-	file, err := os.Open(teamCfgFile)
+	userConfig, err := codec.ReadFile(teamCfgFile)
 	if err != nil {
-		log.Println("Failed to open file:", teamCfgFile)
-		return "", err
+		log.Println("Failed to read config file:", teamCfgFile, err)
+		return nil, err
 	}
-	defer file.Close()
-
-	cfgScanner := bufio.NewScanner(file)
-
-	for cfgScanner.Scan() {
-		text := strings.TrimSpace(cfgScanner.Text())
-		if text == "" || strings.HasPrefix(text, parcer.COMMENT1) || strings.HasPrefix(text, parcer.COMMENT2) || strings.HasPrefix(text, parcer.COMMENT3) {
-			continue
-		}
-		idx := strings.Index(text, "=")
-		if idx >= 0 {
-			k := strings.TrimSpace(text[:idx])
-			v := ""
-			if idx+1 < len(text) {
-				v = strings.TrimSpace(text[idx+1:])
-			}
-			userConfig[k] = v
-		}
+	parcedBlocks, fileList, err := renderConfig(config, teamCfgPath, teamCfgFile, userConfig, mainPath)
+	if err != nil {
+		return fileList, err
+	}
+	for _, w := range template.ReferenceWarnings(parcedBlocks, userConfig) {
+		fmt.Fprintf(os.Stderr, "warning: %s: %s\n", teamCfgFile, w)
 	}
+	return fileList, nil
+}
 
-	// Set the userConfig to parced params object
+/*
+ * Renders the template of the system with the values of the config file into the folder mainPath
+ * Returns
+ * the parsed blocks of the template, Schema holds the REPLACE-ME params by the config key
+ * list of the generated files
+ * error: if any failure
+ */
+func renderConfig(config *cfg.Config, teamCfgPath string, teamCfgFile string, userConfig map[string]string, mainPath string) (*parser.TFBlocks, []string, error) {
 	for k, v := range userConfig {
-		var newParam parcer.ParamValue
-		newParam.P_value = v
-		parcedBlocks.Param[k] = newParam
 		log.Println(k, "=>", v)
 	}
 
-	// create the main.tf
-	mainPath := path.Join(teamCfgPath, config.CachePath)
+	source := template.SystemSource(config, teamCfgPath, userConfig)
+	// references to the outputs of the other systems are resolved before the template is rendered
+	myenv := cfg.GetEnvFromConfFile(codec.Base(filepath.Base(teamCfgFile)))
+	userConfig, err := resolveSystemRefs(config, filepath.Base(teamCfgPath), myenv, userConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl, err := template.Load(config, source)
+	if err != nil {
+		log.Println("Failed to load the template:", source)
+		return nil, nil, err
+	}
+	if tmpl.Remote != nil {
+		checkRemoteTemplate(config, teamCfgFile, tmpl.Remote, userConfig)
+	}
+
+	// create the .cache folder
 	if _, err := os.Stat(mainPath); os.IsNotExist(err) { // Create Path if not present
-		err = os.Mkdir(mainPath, 0755) //create a directory
+		err = os.MkdirAll(mainPath, 0755) //create a directory
 		if err != nil {
 			log.Println("Failed to create directory", mainPath) //print the error on the console
-			return "", err
+			return nil, nil, err
 		}
 	}
 
-	mainFile := path.Join(mainPath, config.Modfile)
-	oFile, err := os.OpenFile(mainFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	varRefs := config.RenderMode == cfg.RENDER_TFVARS
+	if varRefs && tmpl.HasFile(VARIABLES_FILE) {
+		return nil, nil, fmt.Errorf("template %s has %s, it can not be rendered in %s mode", source, VARIABLES_FILE, cfg.RENDER_TFVARS)
+	}
+
+	// Render the template files
+	parcedBlocks, fileList, err := tmpl.Render(userConfig, mainPath, varRefs)
 	if err != nil {
-		log.Println("Failed to open file:", mainFile)
-		return mainFile, err
+		log.Println("Failed to render the template:", source)
+		return nil, nil, err
 	}
-	defer oFile.Close()
 
-	// Parce the template main.tf
-	parcedBlocks.Skip = true
-	_, err = parcer.ParseTF(config.Modfile, &parcedBlocks, oFile)
+	if varRefs {
+		varsFile, err := WriteVariables(config, mainPath, parcedBlocks.Schema)
+		if err != nil {
+			return nil, fileList, err
+		}
+		reqWorkspace := GetConfigWorkspace(teamCfgFile)
+		tfvarsFile, err := WriteTfvars(mainPath, reqWorkspace, parcedBlocks.Schema, userConfig)
+		if err != nil {
+			return nil, fileList, err
+		}
+		fileList = append(fileList, varsFile, tfvarsFile)
+	} else if !tmpl.HasFile(VARIABLES_FILE) {
+		// variables without values fail the plan, remove the ones of an earlier tfvars render
+		os.Remove(path.Join(mainPath, VARIABLES_FILE))
+	}
+
+	backendFile, err := writeBackendOverride(config, mainPath)
 	if err != nil {
-		log.Println("Failed to parse file:", config.Modfile)
-		return "", err
+		return nil, fileList, err
+	}
+	if backendFile != "" {
+		fileList = append(fileList, backendFile)
 	}
 
-	//parcedBlocks.Walk(0, config.Tabsize, oFile)
+	return parcedBlocks, fileList, nil
+}
 
-	return mainFile, nil
+/*
+ * Warns if the remote template differs from the one recorded in the config or a newer version exists
+ */
+func checkRemoteTemplate(config *cfg.Config, teamCfgFile string, remote *template.Resolved, userConfig map[string]string) {
+	if commit := userConfig[cfg.TEMPLATE_COMMIT_KEY]; commit != "" && remote.Commit != "" && commit != remote.Commit {
+		fmt.Fprintf(os.Stderr, "warning: %s: template %s is at commit %s, the config records %s\n", teamCfgFile, remote.Source, remote.Commit, commit)
+	}
+	if checksum := userConfig[cfg.TEMPLATE_CHECKSUM_KEY]; checksum != "" && checksum != remote.Checksum {
+		fmt.Fprintf(os.Stderr, "warning: %s: checksum of the template %s differs from the config, %s != %s\n", teamCfgFile, remote.Source, remote.Checksum, checksum)
+	}
+	latest, err := template.Latest(config, remote.Source)
+	if err != nil {
+		log.Println("Failed to check the latest version of", remote.Source, err)
+	} else if latest != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s: template %s is pinned to %s, newer version %s is available\n", teamCfgFile, remote.Source, remote.Ref, latest)
+	}
 }
 
 func ProcessConfigFiles(config *cfg.Config, myenv string) ([]string, error) {
+	return processConfigFiles(config, myenv, "", "", true)
+}
+
+/*
+ * Renders the config files of the environment
+ * system: renders only the named system if set
+ * outDir: renders each system into <outDir>/<system> instead of its .cache folder if set
+ * deferFailed: a system that fails to render is listed with its .cache folder instead of failing the rendering,
+ * plan and apply render it again when it runs, it fails then and the systems depending on it are skipped
+ */
+func processConfigFiles(config *cfg.Config, myenv string, system string, outDir string, deferFailed bool) ([]string, error) {
 	var fileList []string
+	systems, err := systemConfigs(config, myenv, system)
+	if err != nil {
+		return fileList, err
+	}
+
+	for _, sc := range systems {
+		var genfiles []string
+		mainPath := path.Join(sc.Path, config.CachePath)
+		if outDir != "" {
+			mainPath = path.Join(outDir, sc.Name)
+			genfiles, err = RenderConfigFile(config, sc.Path, sc.File, mainPath)
+		} else {
+			genfiles, err = ReadConfigFile(config, sc.Path, sc.File)
+		}
+		var diags parser.Diagnostics
+		var refErr *SystemRefError
+		if errors.As(err, &refErr) && deferFailed {
+			// the referenced system may run before it, plan and apply render the system again when it runs
+			fmt.Fprintf(os.Stderr, "warning: %s: %v, it is rendered when %s runs\n", sc.File, err, sc.Name)
+			fileList = append(fileList, mainPath)
+			continue
+		} else if errors.As(err, &diags) {
+			// errors in the template abort the plan
+			fmt.Fprintln(os.Stderr, "Failed to generate", sc.File)
+			return nil, err
+		} else if err != nil {
+			if !deferFailed {
+				return nil, fmt.Errorf("%s: %w", sc.File, err)
+			}
+			fmt.Fprintln(os.Stderr, "Failed to generate", sc.File, ":", err)
+			// the system renders again when it runs and fails, so the systems depending on it are skipped
+			fileList = append(fileList, mainPath)
+			continue
+		}
+		fileList = append(fileList, genfiles...)
+	}
+
+	return fileList, nil
+}
+
+// structure holds the config file of a system
+type systemConfig struct {
+	// name of the system
+	Name string
+	// folder of the system (eg: src/sys1)
+	Path string
+	// config file of the environment
+	File string
+}
+
+/*
+ * Returns the systems having a config file for the environment
+ * a system comes after the systems its config references (eg: ${system.network.outputs.vpc_id}),
+ * otherwise the systems are in the order of the names
+ * system: returns only the named system if set
+ */
+func systemConfigs(config *cfg.Config, myenv string, system string) ([]systemConfig, error) {
+	var systems []systemConfig
 	confPath := config.ConfPath
 	entries, err := os.ReadDir(confPath)
-
 	if err != nil {
 		log.Println(err)
-		return fileList, err
+		return nil, err
 	}
 
 	for _, v := range entries {
 		if !v.IsDir() {
 			continue
 		}
-		//fmt.Println(v.Name())
-
-		teamCfgFile := path.Join(confPath, v.Name(), config.GetConfFile(myenv))
-		if _, err := os.Stat(teamCfgFile); err == nil {
+		teamCfgFile := codec.Locate(path.Join(confPath, v.Name(), config.GetConfFile(myenv)))
+		if teamCfgFile != "" {
 			log.Printf("File %s exists\n", teamCfgFile)
-			teamCfgPath := path.Join(confPath, v.Name())
-			genfile, err := ReadConfigFile(config, teamCfgPath, teamCfgFile)
-			if err == nil {
-				fileList = append(fileList, genfile)
-			}
+			systems = append(systems, systemConfig{Name: v.Name(), Path: path.Join(confPath, v.Name()), File: teamCfgFile})
 		}
 	}
-
-	return fileList, nil
+	systems, err = orderSystems(systems, myenv)
+	if err != nil || system == "" {
+		return systems, err
+	}
+	for _, sc := range systems {
+		if sc.Name == system {
+			return []systemConfig{sc}, nil
+		}
+	}
+	return nil, nil
 }
 
+/*
+ * Returns the environment (workspace) set in the config file, default if not set
+ */
 func GetConfigWorkspace(teamCfgFile string) string {
-	file, err := os.Open(teamCfgFile)
 	log.Println("GetConfigWorkspace", teamCfgFile)
+	userConfig, err := codec.ReadFile(teamCfgFile)
 	if err != nil {
-		log.Println("Failed to open file:", teamCfgFile)
+		log.Println("Failed to read config file:", teamCfgFile, err)
 		return cfg.WORKSPACE_DEF
 	}
-	defer file.Close()
 
-	cfgScanner := bufio.NewScanner(file)
+	v, ok := userConfig[cfg.WORKSPACE_KEY]
+	if !ok || v == "" {
+		return cfg.WORKSPACE_DEF
+	}
+	return strings.Trim(v, "\"")
+}
 
-	v := cfg.WORKSPACE_DEF
-	for cfgScanner.Scan() {
-		text := strings.TrimSpace(cfgScanner.Text())
-		if text == "" || strings.HasPrefix(text, parcer.COMMENT1) || strings.HasPrefix(text, parcer.COMMENT2) || strings.HasPrefix(text, parcer.COMMENT3) {
-			continue
+/*
+ * Returns the .cache folders of the generated files, in the order of the files
+ * the list may have the .cache folder of a system that is rendered when it runs
+ */
+func cacheDirs(config *cfg.Config, fileList []string) []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, f := range fileList {
+		dir := filepath.Dir(f)
+		if filepath.Base(f) == config.CachePath {
+			dir = f
 		}
-		idx := strings.Index(text, "=")
-		if idx >= 0 {
-			k := strings.TrimSpace(text[:idx])
-			if idx+1 < len(text) {
-				v = strings.TrimSpace(text[idx+1:])
-				if strings.HasSuffix(v, "\"") {
-					v = strings.Trim(v, "\"")
-				}
-			}
-			if k == cfg.WORKSPACE_KEY {
-				return v
-			}
+		for dir != "." && dir != string(os.PathSeparator) && filepath.Base(dir) != config.CachePath {
+			dir = filepath.Dir(dir)
 		}
+		if filepath.Base(dir) != config.CachePath || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
 	}
-	return v
+	return dirs
 }
 
 /*
- * Runs terraform plan on the generated files
+ * Runs terraform plan, apply or destroy on the generated files, the progress is written to out
+ * a system runs after the systems it depends on (before them for destroy), the systems that do not
+ * depend on each other run at the same time, at most PARALLEL_SYSTEMS of them
+ * a system is skipped if a system it depends on failed or was skipped
+ * the result of each system is recorded as the status of its last run
  * Returns
+ * the result of each system, in the order they run
  * error: if any failure
  */
-func VdexTerraformExecute(config *cfg.Config, fileList []string, tfparam string, tfinit bool, myenv string) error {
+func VdexTerraformExecute(config *cfg.Config, fileList []string, tfparam string, tfinit bool, myenv string, out io.Writer) ([]RunResult, error) {
 	log.Printf("\nIn VdexPlanExecute")
-	app := "terraform"
+	if !NewTerraform("").Found() {
+		log.Printf("\n terraform binary not found %s", TerraformApp())
+		fmt.Fprintf(out, "\n terraform binary not found %s", TerraformApp())
+	}
 
-	if runtime.GOOS == "windows" {
-		app = "terraform.exe"
+	tfPaths := make(map[string]string)
+	var names []string
+	for _, tfPath := range cacheDirs(config, fileList) {
+		name := filepath.Base(filepath.Dir(tfPath))
+		tfPaths[name] = tfPath
+		names = append(names, name)
 	}
-	_, err := exec.LookPath(app)
+	// a system listed by its .cache folder is rendered when it runs
+	pending := make(map[string]bool)
+	for _, f := range fileList {
+		if filepath.Base(f) == config.CachePath {
+			pending[filepath.Base(filepath.Dir(f))] = true
+		}
+	}
+	systems, err := systemConfigs(config, myenv, "")
+	if err != nil {
+		return nil, err
+	}
+	deps, err := systemGraph(systems, myenv)
 	if err != nil {
-		log.Printf("\n terraform binary not found %s", app)
-		fmt.Printf("\n terraform binary not found %s", app)
+		return nil, err
+	}
+	g := deps.Subgraph(names)
+	for _, name := range names {
+		g.Add(name)
+	}
+	if tfparam == "destroy" {
+		// a system is destroyed before the systems it depends on
+		g = g.Reverse()
 	}
 
-	curPath, err := os.Getwd()
+	// the progress of a system is written at once when it is done, the systems run at the same time
+	var mu sync.Mutex
+	results := make(map[string]RunResult)
+	done := func(result RunResult, progress *bytes.Buffer) {
+		mu.Lock()
+		defer mu.Unlock()
+		out.Write(progress.Bytes())
+		results[result.System] = result
+	}
+	order, err := g.Walk(PARALLEL_SYSTEMS, func(name string) bool {
+		var progress bytes.Buffer
+		result := recordResult(config, runSystem(config, tfPaths[name], tfparam, tfinit, pending[name], myenv, &progress), &progress)
+		done(result, &progress)
+		return result.Status == RUN_SUCCESS
+	}, func(name string, dep string) {
+		var progress bytes.Buffer
+		reason := fmt.Sprintf("skipped, %s of %s did not succeed", tfparam, dep)
+		log.Println("Skipping terraform", tfparam, "in", tfPaths[name], reason)
+		fmt.Fprintf(&progress, "Skipping terraform %s in %s, %s of %s did not succeed\n", tfparam, tfPaths[name], tfparam, dep)
+		result := RunResult{
+			System:      name,
+			Environment: myenv,
+			Workspace:   GetConfigWorkspace(codec.Locate(filepath.Join(filepath.Dir(tfPaths[name]), config.GetConfFile(myenv)))),
+			Command:     tfparam,
+			Status:      RUN_SKIPPED,
+			Started:     time.Now(),
+			Errors:      []string{reason},
+			CachePath:   tfPaths[name],
+		}
+		done(recordResult(config, result, &progress), &progress)
+	})
 	if err != nil {
-		log.Printf("Failed to get the current directory\n %s", err)
-	} else {
-		log.Printf("current working path %s", curPath)
+		return nil, fmt.Errorf("system dependencies of environment %s: %w", myenv, err)
 	}
 
-	for _, tfFile := range fileList {
+	ordered := make([]RunResult, 0, len(order))
+	for _, name := range order {
+		ordered = append(ordered, results[name])
+	}
+	return ordered, nil
+}
 
-		// get the service-team path and cd to it
-		idx := strings.LastIndex(tfFile, config.Modfile)
+/*
+ * Runs terraform in the .cache folder of a system, the progress is written to out
+ * the workspace of the config is selected first, the working directory and the environment of vdex
+ * are not changed so that the systems can run at the same time
+ * render: the system is rendered first, its render failed or needs the outputs of the systems that ran before it
+ * Returns the result of the run
+ */
+func runSystem(config *cfg.Config, tfPath string, tfparam string, tfinit bool, render bool, myenv string, out io.Writer) RunResult {
+	result := RunResult{
+		System:      filepath.Base(filepath.Dir(tfPath)),
+		Environment: myenv,
+		Command:     tfparam,
+		Status:      RUN_SUCCESS,
+		Started:     time.Now(),
+		CachePath:   tfPath,
+	}
 
-		if idx < 0 {
-			continue
-		}
-		tfPath := "."
-		if idx > 0 {
-			tfPath = tfFile[:idx]
-		}
-		err = os.Chdir(tfPath)
-		if err != nil {
-			log.Printf("\nFailed to cd the directory to service-team %s", tfPath)
-			continue
-		}
-		log.Printf("\ncd the directory to service-team %s", tfPath)
+	// the outputs of the systems it references are known once they have run
+	if err := renderSystemRefs(config, filepath.Dir(tfPath), myenv, render); err != nil {
+		log.Println("Failed to render", result.System, err)
+		fmt.Fprintln(out, "Failed to render", result.System, ":", err)
+		result.Status, result.Errors = RUN_FAILED, []string{err.Error()}
+		result.Duration = time.Since(result.Started).Seconds()
+		return result
+	}
 
-		// Read the resired workspace
-		reqWorkspace := GetConfigWorkspace(filepath.Join(".."+string(os.PathSeparator), config.GetConfFile(myenv)))
-		reqWSExists := false
+	// Read the desired workspace
+	reqWorkspace := GetConfigWorkspace(codec.Locate(filepath.Join(filepath.Dir(tfPath), config.GetConfFile(myenv))))
+	result.Workspace = reqWorkspace
+
+	// the .cache folder is shared by the environments, the workspace is selected in the backend of this one
+	if err := SelectBackend(config, tfPath, result.System, myenv); err != nil {
+		log.Println(err.Error())
+		fmt.Fprintln(out, err.Error())
+		result.Status, result.Errors = RUN_FAILED, commandErrors("init", err)
+		result.Duration = time.Since(result.Started).Seconds()
+		return result
+	}
 
-		// Check the existing workspaces
-		curWSExists := false
-		curWorkspace := cfg.WORKSPACE_DEF
-		cmdoutput, err := exec.Command(app, "workspace", "list").Output()
-		if err != nil {
-			log.Println(err.Error())
-			fmt.Println("No terraform workspaces found")
-		} else {
-			wsLines := strings.Split(string(cmdoutput), "\n")
-			for _, wline := range wsLines {
-				wline = strings.TrimSpace(wline)
-				if strings.Contains(wline, "*") {
-					curWSExists = true
-					curWorkspace = strings.TrimSpace(strings.Trim(wline, "*"))
-					if curWorkspace == reqWorkspace {
-						reqWSExists = true
-						break
-					}
-				}
-				if wline == reqWorkspace {
-					reqWSExists = true
-				}
-			}
-		}
-		if curWSExists {
-			fmt.Println("Current Workspace", curWorkspace, ", desired Workspace", reqWorkspace)
-		}
+	// Check the existing workspaces
+	tf := NewTerraform(tfPath)
+	workspaces, curWorkspace, err := tf.Workspaces()
+	if err != nil {
+		log.Println(err.Error())
+		fmt.Fprintln(out, "No terraform workspaces found")
+	}
+	if curWorkspace != "" {
+		fmt.Fprintln(out, "Current Workspace", curWorkspace, ", desired Workspace", reqWorkspace)
+	} else {
+		curWorkspace = cfg.WORKSPACE_DEF
+	}
 
-		if curWorkspace != reqWorkspace { // create the workspace
-			//terraform [global options] workspace select NAME
-			if !reqWSExists {
-				log.Println("Creating Workspace", reqWorkspace)
-				fmt.Println("Creating Workspace", reqWorkspace)
-			}
-			cmdoutput, err = exec.Command(app, "workspace", "select", "-or-create", reqWorkspace).Output()
-			if err != nil {
-				log.Println(err.Error())
-				log.Println(cmdoutput)
-				log.Println("Failed to switch to workspace", reqWorkspace)
-				fmt.Println("workspace", reqWorkspace, "switch, need terraform init")
-				//cmdoutput, err = exec.Command(app, "workspace", "new", reqWorkspace).Output()
-				//if err != nil {
-				//	log.Println(err.Error())
-				//	log.Println(cmdoutput)
-				//	log.Println("Failed to create workspace", reqWorkspace)
-				//	fmt.Println("Failed to create workspace", reqWorkspace, ". Using deafult workspace")
-				//}
-			} else {
-				log.Println("selected workspace", reqWorkspace)
-				fmt.Println("Switched to workspace", reqWorkspace)
-			}
-		} else if !curWSExists {
-			fmt.Println("Setting workspace", reqWorkspace)
+	if curWorkspace != reqWorkspace { // create the workspace
+		if !slices.Contains(workspaces, reqWorkspace) {
+			log.Println("Creating Workspace", reqWorkspace)
+			fmt.Fprintln(out, "Creating Workspace", reqWorkspace)
 		}
-
-		if tfinit {
-			os.Setenv("TF_WORKSPACE", reqWorkspace)
-			// execute terraform init command
-			fmt.Println("terraform init...")
-			cmdoutput, err := exec.Command(app, "init").Output()
-
-			if err != nil {
-				log.Println(err.Error())
-				log.Println("Failed to execute terraform", "init", "in", tfPath)
-				fmt.Println(err.Error())
-				fmt.Println("Failed to execute terraform", "init", "in", tfPath)
-				fmt.Println("Please check your terraform installation or internet connection")
-			} else {
-				log.Println(string(cmdoutput))
-				log.Println("Successfully executed terraform", "init", "in", tfPath)
-				//fmt.Println(string(cmdoutput))
-				fmt.Println("Successfully executed terraform", "init", "in", tfPath)
-			}
+		if _, err := tf.Run("workspace", "select", "-or-create", reqWorkspace); err != nil {
+			log.Println(err.Error())
+			log.Println("Failed to switch to workspace", reqWorkspace)
+			fmt.Fprintln(out, "workspace", reqWorkspace, "switch, need terraform init")
+		} else {
+			log.Println("selected workspace", reqWorkspace)
+			fmt.Fprintln(out, "Switched to workspace", reqWorkspace)
 		}
+	} else if len(workspaces) == 0 {
+		fmt.Fprintln(out, "Setting workspace", reqWorkspace)
+	}
 
-		// execute terraform plan or apply command
-		cmdoutput, err = exec.Command(app, tfparam).Output()
+	tf = NewTerraform(tfPath, "TF_WORKSPACE="+reqWorkspace)
+	if tfinit {
+		// execute terraform init command
+		fmt.Fprintln(out, "terraform init...")
+		cmdoutput, err := initBackend(config, tf, result.System, myenv)
 
 		if err != nil {
-			fmt.Println(err.Error())
-			fmt.Println("Failed to execute terraform", tfparam, "in", tfPath)
-			fmt.Println("Please verify validity of the terraform or network connection")
 			log.Println(err.Error())
-			log.Println("Failed to execute terraform", tfparam, "in", tfPath)
+			log.Println("Failed to execute terraform", "init", "in", tfPath)
+			fmt.Fprintln(out, err.Error())
+			fmt.Fprintln(out, "Failed to execute terraform", "init", "in", tfPath)
+			fmt.Fprintln(out, "Please check your terraform installation or internet connection")
+			result.Status = RUN_FAILED
+			result.Errors = append(result.Errors, commandErrors("init", err)...)
 		} else {
-			//fmt.Println(string(cmdoutput))
-			fmt.Println("Successfully executed terraform", tfparam, "in", tfPath)
 			log.Println(string(cmdoutput))
-			log.Println("Successfully executed terraform", tfparam, "in", tfPath)
+			log.Println("Successfully executed terraform", "init", "in", tfPath)
+			fmt.Fprintln(out, "Successfully executed terraform", "init", "in", tfPath)
 		}
+	}
+
+	// execute terraform plan, apply or destroy command
+	tfargs := []string{tfparam}
+	if tfparam == "destroy" {
+		// vdex destroy has asked for the confirmation of the environment
+		tfargs = append(tfargs, "-auto-approve")
+	}
+	if config.RenderMode == cfg.RENDER_TFVARS {
+		tfargs = append(tfargs, "-var-file="+TfvarsFile(reqWorkspace))
+	}
+	cmdoutput, err := tf.Run(tfargs...)
+
+	if err != nil {
+		fmt.Fprintln(out, err.Error())
+		fmt.Fprintln(out, "Failed to execute terraform", tfparam, "in", tfPath)
+		fmt.Fprintln(out, "Please verify validity of the terraform or network connection")
+		log.Println(err.Error())
+		log.Println("Failed to execute terraform", tfparam, "in", tfPath)
+		result.Status = RUN_FAILED
+		result.Errors = append(result.Errors, commandErrors(tfparam, err)...)
+	} else {
+		fmt.Fprintln(out, "Successfully executed terraform", tfparam, "in", tfPath)
+		log.Println(string(cmdoutput))
+		log.Println("Successfully executed terraform", tfparam, "in", tfPath)
+	}
+	result.Resources = ParseResourceCounts(string(cmdoutput))
+	result.Duration = time.Since(result.Started).Seconds()
+	return result
+}
 
-		// Return to the working directory
-		err = os.Chdir(curPath)
+/*
+ * Records the result as the status of the last run and in the history of the system
+ * a snapshot is taken after a successful apply
+ * Returns the result with the id of the snapshot
+ */
+func recordResult(config *cfg.Config, result RunResult, out io.Writer) RunResult {
+	entry := NewHistoryEntry(config, result)
+	if result.Command == "apply" && result.Status == RUN_SUCCESS {
+		snap, err := snapshot.Create(config, entry, result.CachePath)
 		if err != nil {
-			log.Printf("\nFailed to return to the working path %s", curPath)
+			log.Println("Failed to take the snapshot of", result.System, err)
+			fmt.Fprintln(out, "Failed to take the snapshot of", result.System, ":", err)
+		} else {
+			fmt.Fprintln(out, "Snapshot", snap.ID, "of", result.System, "is saved in", snap.Dir)
+			result.Snapshot, entry.Snapshot = snap.ID, snap.ID
 		}
 	}
-	return nil
+	if err := WriteStatus(config, result); err != nil {
+		log.Println("Failed to write the status of", result.System, err)
+	}
+	if err := history.Append(config, entry); err != nil {
+		log.Println("Failed to record the history of", result.System, err)
+		fmt.Fprintln(out, "Failed to record the history of", result.System, ":", err)
+	}
+	return result
+}
+
+// returns the error messages of the failed terraform command
+func commandErrors(tfparam string, err error) []string {
+	// the error of Terraform.Run holds the standard error of the command
+	if errs := ParseErrors(err.Error()); len(errs) > 0 {
+		return errs
+	}
+	return []string{fmt.Sprintf("terraform %s: %v", tfparam, err)}
 }
 
 /*
@@ -0,0 +1,72 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	cfg "vdex/config"
+)
+
+/*
+ * Renders the config of the environment without running terraform
+ * system: renders only the named system if set
+ * outDir: renders each system into <outDir>/<system> instead of its .cache folder if set
+ * stdout: writes the rendered files to w instead of keeping them, each file is preceded
+ * by a comment with its name when more than one file is rendered
+ * Returns
+ * list of the generated files
+ * error: if any failure
+ */
+func VdexRender(config *cfg.Config, myenv string, system string, outDir string, stdout bool, w io.Writer) ([]string, error) {
+	log.Printf("\nIn VdexRender")
+
+	if err := checkSystem(config, system); err != nil {
+		return nil, err
+	}
+	if !stdout {
+		return processConfigFiles(config, myenv, system, outDir, false)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "vdex-render-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fileList, err := processConfigFiles(config, myenv, system, tmpDir, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fileList {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if len(fileList) > 1 {
+			rel, err := filepath.Rel(tmpDir, f)
+			if err != nil {
+				rel = f
+			}
+			fmt.Fprintf(w, "# %s\n", filepath.ToSlash(rel))
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	return fileList, nil
+}
+
+/*
+ * Returns error if the system is set and its folder does not exist
+ */
+func checkSystem(config *cfg.Config, system string) error {
+	if system == "" {
+		return nil
+	}
+	if info, err := os.Stat(filepath.Join(config.ConfPath, system)); err != nil || !info.IsDir() {
+		return fmt.Errorf("system %s not found in %s", system, config.ConfPath)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package plan
+
+import (
+	"os"
+	"path"
+	"slices"
+	"testing"
+	cfg "vdex/config"
+)
+
+func TestRenderFailure(t *testing.T) {
+	dir := t.TempDir()
+	config := cfg.NewConfig()
+	config.ConfPath = path.Join(dir, "src")
+	config.ProjectPath = path.Join(dir, ".vdex")
+	config.Modfile = path.Join(dir, "main.tf")
+	files := map[string]string{
+		config.Modfile: "module \"echo\" {\n    name = \"x\" // REPLACE-ME\n}\n",
+		path.Join(config.ConfPath, "app", "dev-config.txt"): "module \"echo\".name = \"app\"\n",
+		// the template of the system can not be loaded
+		path.Join(config.ConfPath, "web", "dev-config.txt"): "template = missing.tf\nmodule \"echo\".name = \"web\"\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// plan and apply keep the system, it fails when it runs and its dependents are skipped
+	fileList, err := processConfigFiles(&config, "dev", "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{path.Join(config.ConfPath, "app", ".cache", "main.tf"), path.Join(config.ConfPath, "web", ".cache")}
+	if !slices.Equal(fileList, want) {
+		t.Errorf("processConfigFiles() = %v, want %v", fileList, want)
+	}
+
+	// render fails
+	for _, outDir := range []string{"", path.Join(dir, "out")} {
+		if fileList, err := processConfigFiles(&config, "dev", "", outDir, false); err == nil {
+			t.Errorf("processConfigFiles(out %q) = %v, want an error", outDir, fileList)
+		}
+	}
+	if _, err := processConfigFiles(&config, "dev", "app", path.Join(dir, "out"), false); err != nil {
+		t.Errorf("processConfigFiles(app) error = %v", err)
+	}
+}
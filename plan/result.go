@@ -0,0 +1,242 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"vdex/codec"
+	cfg "vdex/config"
+	"vdex/history"
+	"vdex/output"
+	"vdex/template"
+)
+
+// Status of a terraform run
+const (
+	RUN_SUCCESS = "success"
+	RUN_FAILED  = "failed"
+	// not run as a system it depends on did not succeed
+	RUN_SKIPPED = "skipped"
+)
+
+// number of systems terraform runs for at the same time
+const PARALLEL_SYSTEMS = 4
+
+// folder of the project holding the status of the last run per system and environment
+const STATUS_PATH = "status"
+
+// number of resources changed by a plan or an apply
+type ResourceCounts struct {
+	Add     int `json:"add" yaml:"add"`
+	Change  int `json:"change" yaml:"change"`
+	Destroy int `json:"destroy" yaml:"destroy"`
+}
+
+// structure holds the result of running terraform for a system
+type RunResult struct {
+	// name of the system
+	System string `json:"system" yaml:"system"`
+	// environment of the config
+	Environment string `json:"environment" yaml:"environment"`
+	// terraform workspace
+	Workspace string `json:"workspace" yaml:"workspace"`
+	// terraform command (plan or apply)
+	Command string `json:"command" yaml:"command"`
+	// success or failed
+	Status string `json:"status" yaml:"status"`
+	// start time of the run
+	Started time.Time `json:"started" yaml:"started"`
+	// duration of the run in seconds
+	Duration float64 `json:"duration_seconds" yaml:"duration_seconds"`
+	// resources changed by the run, nil if terraform did not report them
+	Resources *ResourceCounts `json:"resources,omitempty" yaml:"resources,omitempty"`
+	// error messages of terraform
+	Errors []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+	// folder terraform ran in
+	CachePath string `json:"cache_path" yaml:"cache_path"`
+	// snapshot taken after a successful apply
+	Snapshot string `json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+}
+
+// summaries of the resource counts in the output of terraform
+var (
+	planCounts  = regexp.MustCompile(`(\d+) to add, (\d+) to change, (\d+) to destroy`)
+	applyCounts = regexp.MustCompile(`Resources: (\d+) added, (\d+) changed, (\d+) destroyed`)
+	// terraform destroy reports the destroyed resources only
+	destroyCounts = regexp.MustCompile(`Destroy complete! Resources: (\d+) destroyed`)
+	ansiCodes     = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+/*
+ * Returns the resource counts reported in the output of terraform plan, apply or destroy, nil if not found
+ */
+func ParseResourceCounts(output string) *ResourceCounts {
+	output = ansiCodes.ReplaceAllString(output, "")
+	if m := destroyCounts.FindStringSubmatch(output); m != nil {
+		destroy, _ := strconv.Atoi(m[1])
+		return &ResourceCounts{Destroy: destroy}
+	}
+	for _, re := range []*regexp.Regexp{applyCounts, planCounts} {
+		if m := re.FindStringSubmatch(output); m != nil {
+			add, _ := strconv.Atoi(m[1])
+			change, _ := strconv.Atoi(m[2])
+			destroy, _ := strconv.Atoi(m[3])
+			return &ResourceCounts{Add: add, Change: change, Destroy: destroy}
+		}
+	}
+	if strings.Contains(output, "No changes.") {
+		return &ResourceCounts{}
+	}
+	return nil
+}
+
+/*
+ * Returns the error messages found in the standard error of terraform
+ */
+func ParseErrors(stderr string) []string {
+	var errs []string
+	for _, l := range strings.Split(ansiCodes.ReplaceAllString(stderr, ""), "\n") {
+		// messages are framed with box drawing characters, eg: │ Error: Unsupported argument
+		l = strings.TrimSpace(strings.TrimLeft(l, "│╷╵ "))
+		if strings.HasPrefix(l, "Error: ") {
+			errs = append(errs, strings.TrimPrefix(l, "Error: "))
+		}
+	}
+	return errs
+}
+
+/*
+ * Returns the status file of the system and environment (eg: .vdex/status/sys1/dev.json)
+ */
+func StatusFile(config *cfg.Config, system string, myenv string) string {
+	return filepath.Join(config.ProjectPath, STATUS_PATH, system, myenv+".json")
+}
+
+/*
+ * Writes the result as the status of the last run of its system and environment
+ */
+func WriteStatus(config *cfg.Config, result RunResult) error {
+	file := StatusFile(config, result.System, result.Environment)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+/*
+ * Reads the status of the last run of the system and environment
+ * Returns nil if the system was not planned or applied yet
+ */
+func ReadStatus(config *cfg.Config, system string, myenv string) (*RunResult, error) {
+	data, err := os.ReadFile(StatusFile(config, system, myenv))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var result RunResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+/*
+ * Writes the results in the format (table, json or yaml)
+ */
+func WriteResults(w io.Writer, format string, results []RunResult) error {
+	if results == nil {
+		results = []RunResult{}
+	}
+	if format != output.FORMAT_TABLE {
+		return output.Write(w, format, results)
+	}
+	table := output.NewTable("system-name", "environment", "command", "status", "duration", "add", "change", "destroy")
+	for _, r := range results {
+		add, change, destroy := "-", "-", "-"
+		if r.Resources != nil {
+			add, change, destroy = strconv.Itoa(r.Resources.Add), strconv.Itoa(r.Resources.Change), strconv.Itoa(r.Resources.Destroy)
+		}
+		table.Add(r.System, r.Environment, r.Command, r.Status, fmt.Sprintf("%.1fs", r.Duration), add, change, destroy)
+	}
+	return table.Write(w)
+}
+
+/*
+ * Returns the history entry of the result
+ * with the user, the git commit and the checksums of the config and the template
+ */
+func NewHistoryEntry(config *cfg.Config, result RunResult) history.Entry {
+	entry := history.Entry{
+		Time:        result.Started,
+		Command:     result.Command,
+		User:        history.CurrentUser(),
+		Host:        history.Hostname(),
+		System:      result.System,
+		Environment: result.Environment,
+		Workspace:   result.Workspace,
+		Status:      result.Status,
+		Resources:   (*history.Counts)(result.Resources),
+		Errors:      result.Errors,
+		Duration:    result.Duration,
+		Snapshot:    result.Snapshot,
+	}
+	entry.Commit, entry.Dirty = history.GitCommit(config.ProjectPath)
+
+	teamCfgPath := filepath.Join(config.ConfPath, result.System)
+	entry.ConfigFile = codec.Locate(filepath.Join(teamCfgPath, config.GetConfFile(result.Environment)))
+	if entry.ConfigFile != "" {
+		var err error
+		if entry.ConfigHash, err = history.FileHash(entry.ConfigFile); err != nil {
+			log.Println("Failed to hash the config", entry.ConfigFile, err)
+		}
+		userConfig, err := codec.ReadFile(entry.ConfigFile)
+		if err != nil {
+			log.Println("Failed to read config file:", entry.ConfigFile, err)
+		}
+		entry.Template = template.SystemSource(config, teamCfgPath, userConfig)
+		if tmpl, err := template.Load(config, entry.Template); err != nil {
+			log.Println("Failed to load the template:", entry.Template, err)
+		} else if entry.TemplateHash, err = tmpl.Checksum(); err != nil {
+			log.Println("Failed to hash the template:", entry.Template, err)
+		}
+	}
+	return entry
+}
+
+/*
+ * Writes the history entries in the format (table, json or yaml)
+ */
+func WriteHistory(w io.Writer, format string, entries []history.Entry) error {
+	if format != output.FORMAT_TABLE {
+		return output.Write(w, format, entries)
+	}
+	table := output.NewTable("time", "system-name", "environment", "command", "status", "user", "commit", "add", "change", "destroy", "duration")
+	for _, e := range entries {
+		add, change, destroy := "-", "-", "-"
+		if e.Resources != nil {
+			add, change, destroy = strconv.Itoa(e.Resources.Add), strconv.Itoa(e.Resources.Change), strconv.Itoa(e.Resources.Destroy)
+		}
+		commit := e.Commit
+		if len(commit) > 8 {
+			commit = commit[:8]
+		}
+		if e.Dirty {
+			commit += "+"
+		}
+		table.Add(e.Time.Local().Format("2006-01-02 15:04:05"), e.System, e.Environment, e.Command, e.Status,
+			e.User, commit, add, change, destroy, fmt.Sprintf("%.1fs", e.Duration))
+	}
+	return table.Write(w)
+}
@@ -0,0 +1,51 @@
+package plan
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseResourceCounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   *ResourceCounts
+	}{
+		{"plan", "Plan: 2 to add, 1 to change, 0 to destroy.", &ResourceCounts{Add: 2, Change: 1}},
+		{"plan with colors", "\x1b[1mPlan:\x1b[0m 3 to add, 0 to change, 4 to destroy.", &ResourceCounts{Add: 3, Destroy: 4}},
+		{"apply", "Apply complete! Resources: 1 added, 2 changed, 3 destroyed.", &ResourceCounts{Add: 1, Change: 2, Destroy: 3}},
+		{"destroy", "Destroy complete! Resources: 5 destroyed.", &ResourceCounts{Destroy: 5}},
+		{"no changes", "No changes. Your infrastructure matches the configuration.", &ResourceCounts{}},
+		{"no summary", "Terraform has been successfully initialized!", nil},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseResourceCounts(tt.output)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("ParseResourceCounts(%q) = %+v, want %+v", tt.output, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   []string
+	}{
+		{"framed", "╷\n│ Error: Unsupported argument\n│ \n│   on main.tf line 3\n╵\n", []string{"Unsupported argument"}},
+		{"colors", "\x1b[31m╷\x1b[0m\n\x1b[31m│\x1b[0m \x1b[1m\x1b[31mError: \x1b[0m\x1b[1mInvalid value\x1b[0m\n", []string{"Invalid value"}},
+		{"plain", "Error: No configuration files\n", []string{"No configuration files"}},
+		{"two errors", "│ Error: first\n│ Warning: ignored\n│ Error: second\n", []string{"first", "second"}},
+		{"no error", "Warning: deprecated\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseErrors(tt.stderr); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseErrors(%q) = %q, want %q", tt.stderr, got, tt.want)
+			}
+		})
+	}
+}
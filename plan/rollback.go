@@ -0,0 +1,153 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"vdex/codec"
+	cfg "vdex/config"
+	"vdex/diff"
+	"vdex/output"
+	"vdex/snapshot"
+	"vdex/template"
+)
+
+/*
+ * Restores the config of the system from a snapshot and runs plan and apply on it
+ * - the difference of the current config and the snapshot is shown before the config is restored
+ * - the config is rendered and the difference with the files of the snapshot is shown
+ * - plan runs and apply runs only if confirmed
+ * to: id of the snapshot, latest or previous
+ * confirm: asks the user, the rollback stops when it returns false
+ * Returns
+ * the results of plan and apply, nil if the rollback was not confirmed
+ * error: if any failure
+ */
+func VdexRollback(config *cfg.Config, system string, myenv string, to string, confirm func(string) bool, out io.Writer) ([]RunResult, error) {
+	log.Printf("\nIn VdexRollback")
+
+	if system == "" {
+		return nil, fmt.Errorf("system name is required")
+	}
+	if err := checkSystem(config, system); err != nil {
+		return nil, err
+	}
+	snap, err := snapshot.Find(config, system, myenv, to)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "Rolling back %s in environment %s to snapshot %s (%s by %s)\n",
+		system, myenv, snap.ID, snap.Time.Local().Format("2006-01-02 15:04:05"), snap.User)
+
+	saved, err := os.ReadFile(snap.ConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	teamCfgPath := filepath.Join(config.ConfPath, system)
+	current := codec.Locate(filepath.Join(teamCfgPath, config.GetConfFile(myenv)))
+	currentText, _ := readText(current)
+	restored := filepath.Join(teamCfgPath, filepath.Base(snap.ConfigFile))
+
+	if !diff.Changed(diff.Lines(currentText, string(saved))) && current == restored {
+		fmt.Fprintln(out, "The config is the same as the snapshot")
+	} else {
+		io.WriteString(out, diff.Unified(current, restored+" ("+snap.ID+")", currentText, string(saved), 3))
+		if !confirm("Restore the config of " + system + "?") {
+			return nil, nil
+		}
+		if err := os.WriteFile(restored, saved, 0644); err != nil {
+			return nil, err
+		}
+		// the snapshot may be in another format (eg: dev-config.yaml), only one config file is kept
+		if current != "" && current != restored {
+			if err := os.Remove(current); err != nil {
+				return nil, err
+			}
+		}
+		fmt.Fprintln(out, "Config is restored to", restored)
+	}
+
+	userConfig, err := codec.ReadFile(restored)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl, err := template.Load(config, template.SystemSource(config, teamCfgPath, userConfig)); err != nil {
+		log.Println("Failed to load the template of", system, err)
+	} else if sum, err := tmpl.Checksum(); err == nil && snap.TemplateHash != "" && sum != snap.TemplateHash {
+		fmt.Fprintf(out, "warning: the template %s has changed since the snapshot %s, the rendered files may differ\n", snap.Template, snap.ID)
+	}
+
+	fileList, err := processConfigFiles(config, myenv, system, "", true)
+	if err != nil {
+		return nil, err
+	}
+	mainPath := filepath.Join(teamCfgPath, config.CachePath)
+	names := append(relNames(mainPath, fileList), relNames(snap.FilesDir(), snapshotFiles(snap))...)
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		oldText, _ := readText(filepath.Join(snap.FilesDir(), name))
+		newText, _ := readText(filepath.Join(mainPath, name))
+		if fc := compareFile(oldText, newText, snap.ID+":"+system+"/"+name, system+"/"+name); fc != nil {
+			io.WriteString(out, fc.Unified)
+		}
+	}
+
+	results, err := VdexTerraformExecute(config, fileList, "plan", true, myenv, out)
+	if err != nil {
+		return results, err
+	}
+	for _, r := range results {
+		if r.Status != RUN_SUCCESS {
+			return results, fmt.Errorf("plan of %s failed, apply is skipped", r.System)
+		}
+	}
+	if !confirm("Apply the rollback of " + system + " to " + snap.ID + "?") {
+		return results, nil
+	}
+	applied, err := VdexTerraformExecute(config, fileList, "apply", false, myenv, out)
+	return append(results, applied...), err
+}
+
+// returns the files of the snapshot
+func snapshotFiles(snap *snapshot.Snapshot) []string {
+	var files []string
+	filepath.Walk(snap.FilesDir(), func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files
+}
+
+/*
+ * Writes the snapshots in the format (table, json or yaml)
+ */
+func WriteSnapshots(w io.Writer, format string, snaps []snapshot.Snapshot) error {
+	if format != output.FORMAT_TABLE {
+		return output.Write(w, format, snaps)
+	}
+	table := output.NewTable("id", "time", "user", "commit", "config-file", "add", "change", "destroy")
+	for _, s := range snaps {
+		add, change, destroy := "-", "-", "-"
+		if s.Resources != nil {
+			add, change, destroy = strconv.Itoa(s.Resources.Add), strconv.Itoa(s.Resources.Change), strconv.Itoa(s.Resources.Destroy)
+		}
+		commit := s.Commit
+		if len(commit) > 8 {
+			commit = commit[:8]
+		}
+		if s.Dirty {
+			commit += "+"
+		}
+		table.Add(s.ID, s.Time.Local().Format("2006-01-02 15:04:05"), s.User, commit, filepath.Base(s.ConfigFile), add, change, destroy)
+	}
+	return table.Write(w)
+}
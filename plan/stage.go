@@ -0,0 +1,116 @@
+package plan
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	cfg "vdex/config"
+)
+
+// prefix of the folders a system is rendered into before they take the place of its .cache folder
+const STAGING_PREFIX = ".cache-staging-"
+
+// returns true if the file is a working file of terraform in the .cache folder, it is kept when the system is rendered
+// (eg: .terraform, .terraform.lock.hcl, terraform.tfstate, terraform.tfstate.d)
+func isTerraformData(name string) bool {
+	return strings.HasPrefix(name, ".terraform") || strings.HasPrefix(name, "terraform.tfstate") || strings.HasSuffix(name, ".tfplan")
+}
+
+/*
+ * Renders the system into a new staging folder next to its .cache folder and swaps it in place of the .cache folder
+ * the files of the .cache folder are never written in place, a render that fails leaves the .cache folder as it was
+ * render: renders the system into the folder it is given
+ * Returns
+ * list of the generated files in the .cache folder
+ * error: if any failure
+ */
+func renderStaged(config *cfg.Config, teamCfgPath string, render func(stagePath string) ([]string, error)) ([]string, error) {
+	return renderStagedTo(teamCfgPath, filepath.Join(teamCfgPath, config.CachePath), render)
+}
+
+/*
+ * Renders the system into a new staging folder which then takes the place of the folder cachePath, see renderStaged
+ */
+func renderStagedTo(teamCfgPath string, cachePath string, render func(stagePath string) ([]string, error)) ([]string, error) {
+	stagePath, err := os.MkdirTemp(teamCfgPath, STAGING_PREFIX)
+	if err != nil {
+		log.Println("Failed to create the staging folder in", teamCfgPath, err)
+		return nil, err
+	}
+	defer os.RemoveAll(stagePath)
+	if err := os.Chmod(stagePath, 0755); err != nil {
+		return nil, err
+	}
+
+	fileList, err := render(stagePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := swapCache(cachePath, stagePath); err != nil {
+		log.Println("Failed to replace", cachePath, err)
+		return nil, err
+	}
+	for i, f := range fileList {
+		if rel, err := filepath.Rel(stagePath, f); err == nil {
+			fileList[i] = filepath.Join(cachePath, rel)
+		}
+	}
+	return fileList, nil
+}
+
+/*
+ * Moves the working files of terraform from the .cache folder into the staging folder,
+ * then renames the staging folder to the .cache folder
+ * the .cache folder is restored if a rename fails
+ * the renames are not atomic, the lock of the system (see LockSystems) keeps the other vdex runs out of the folder
+ */
+func swapCache(cachePath string, stagePath string) error {
+	entries, err := os.ReadDir(cachePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var moved []string
+	restore := func() {
+		moveFiles(moved, stagePath, cachePath)
+	}
+	for _, e := range entries {
+		if !isTerraformData(e.Name()) {
+			continue
+		}
+		// a file of the template wins over the one of the previous run (eg: .terraform.lock.hcl)
+		if _, err := os.Lstat(filepath.Join(stagePath, e.Name())); err == nil {
+			continue
+		}
+		if err := os.Rename(filepath.Join(cachePath, e.Name()), filepath.Join(stagePath, e.Name())); err != nil {
+			restore()
+			return err
+		}
+		moved = append(moved, e.Name())
+	}
+
+	// the staging folder name is unique, so is the name the previous .cache folder is moved to
+	oldPath := stagePath + "-old"
+	if err := os.Rename(cachePath, oldPath); err != nil && !os.IsNotExist(err) {
+		restore()
+		return err
+	}
+	if err := os.Rename(stagePath, cachePath); err != nil {
+		os.Rename(oldPath, cachePath)
+		restore()
+		return err
+	}
+	if err := os.RemoveAll(oldPath); err != nil {
+		log.Println("Failed to remove", oldPath, err)
+	}
+	return nil
+}
+
+// moves the files from the folder from to the folder to, failures are logged
+func moveFiles(names []string, from string, to string) {
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(from, name), filepath.Join(to, name)); err != nil {
+			log.Println("Failed to move", name, "back to", to, err)
+		}
+	}
+}
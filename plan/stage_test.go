@@ -0,0 +1,109 @@
+package plan
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSwapCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache map[string]string
+		stage map[string]string
+		want  map[string]string
+	}{
+		{
+			name:  "no cache",
+			stage: map[string]string{"main.tf": "new"},
+			want:  map[string]string{"main.tf": "new"},
+		},
+		{
+			name: "keeps terraform data",
+			cache: map[string]string{
+				"main.tf":                  "old",
+				"stale.tf":                 "old",
+				".terraform/vdex-backend":  "init",
+				"terraform.tfstate":        "state",
+				"terraform.tfstate.backup": "backup",
+				"dev.tfplan":               "plan",
+			},
+			stage: map[string]string{"main.tf": "new"},
+			want: map[string]string{
+				"main.tf":                  "new",
+				".terraform/vdex-backend":  "init",
+				"terraform.tfstate":        "state",
+				"terraform.tfstate.backup": "backup",
+				"dev.tfplan":               "plan",
+			},
+		},
+		{
+			name:  "template lock file wins",
+			cache: map[string]string{".terraform.lock.hcl": "old"},
+			stage: map[string]string{".terraform.lock.hcl": "new"},
+			want:  map[string]string{".terraform.lock.hcl": "new"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cachePath := filepath.Join(dir, ".cache")
+			stagePath := filepath.Join(dir, ".cache-stage")
+			if tt.cache != nil {
+				writeTree(t, cachePath, tt.cache)
+			}
+			writeTree(t, stagePath, tt.stage)
+
+			if err := swapCache(cachePath, stagePath); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTree(t, cachePath); !maps.Equal(got, tt.want) {
+				t.Errorf("cache = %v, want %v", got, tt.want)
+			}
+			entries, _ := os.ReadDir(dir)
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if !slices.Equal(names, []string{".cache"}) {
+				t.Errorf("folders left = %v, want [.cache]", names)
+			}
+		})
+	}
+}
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		files[rel] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
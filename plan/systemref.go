@@ -0,0 +1,187 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"vdex/codec"
+	cfg "vdex/config"
+)
+
+// reference of a config value to an output of another system of the same environment, eg: ${system.network.outputs.vpc_id}
+var systemRef = regexp.MustCompile(`\$\{system\.([A-Za-z_][A-Za-z0-9_-]*)\.outputs\.([A-Za-z_][A-Za-z0-9_-]*)\}`)
+
+// error of a reference to an output that is not available
+type SystemRefError struct {
+	// config key of the value
+	Key string
+	// referenced system and output
+	System string
+	Output string
+	// why the output is not available
+	Reason string
+}
+
+func (e *SystemRefError) Error() string {
+	return fmt.Sprintf("%s references the output %s of system %s: %s", e.Key, e.Output, e.System, e.Reason)
+}
+
+/*
+ * Returns the systems referenced by the config values, in the order of the names
+ */
+func SystemRefs(values map[string]string) []string {
+	found := make(map[string]bool)
+	for _, v := range values {
+		for _, m := range systemRef.FindAllStringSubmatch(v, -1) {
+			found[m[1]] = true
+		}
+	}
+	systems := make([]string, 0, len(found))
+	for s := range found {
+		systems = append(systems, s)
+	}
+	sort.Strings(systems)
+	return systems
+}
+
+/*
+ * Returns the outputs of the system for the environment
+ * terraform output runs in the .cache folder of the system, the outputs saved by vdex output --write are used
+ * if terraform could not give them
+ */
+func referencedOutputs(config *cfg.Config, system string, myenv string) (map[string]Output, error) {
+	teamCfgPath := filepath.Join(config.ConfPath, system)
+	teamCfgFile := codec.Locate(filepath.Join(teamCfgPath, config.GetConfFile(myenv)))
+	if teamCfgFile == "" {
+		return nil, fmt.Errorf("system has no config for environment %s", myenv)
+	}
+	// the referenced system is read only, its .cache folder is not initialized again
+	outputs, err := systemOutputs(config, systemConfig{Name: system, Path: teamCfgPath, File: teamCfgFile}, false)
+	if err == nil {
+		return outputs, nil
+	}
+	log.Println("Failed to run terraform output of", system, err)
+	if saved, serr := ReadOutputs(config, system, myenv); serr == nil {
+		return saved, nil
+	}
+	return nil, fmt.Errorf("outputs are not available, apply %s first: %v", system, err)
+}
+
+/*
+ * Returns the config values with the references to the outputs of the other systems replaced
+ * a reference in a quoted string is replaced with the text of the output, otherwise with its value
+ * as terraform expression (eg: "vpc-0a12", ["a", "b"])
+ * Returns a *SystemRefError if an output is not available
+ */
+func resolveSystemRefs(config *cfg.Config, system string, myenv string, values map[string]string) (map[string]string, error) {
+	if len(SystemRefs(values)) == 0 {
+		return values, nil
+	}
+	cache := make(map[string]map[string]Output)
+	reasons := make(map[string]string)
+	resolved := make(map[string]string, len(values))
+	for _, key := range codec.SortKeys(values) {
+		value := values[key]
+		matches := systemRef.FindAllStringSubmatchIndex(value, -1)
+		if len(matches) == 0 {
+			resolved[key] = value
+			continue
+		}
+		var sb strings.Builder
+		last := 0
+		for _, m := range matches {
+			refSystem, name := value[m[2]:m[3]], value[m[4]:m[5]]
+			fail := func(reason string) error {
+				return &SystemRefError{Key: key, System: refSystem, Output: name, Reason: reason}
+			}
+			if refSystem == system {
+				return nil, fail("a system can not reference itself")
+			}
+			if _, found := cache[refSystem]; !found && reasons[refSystem] == "" {
+				outputs, err := referencedOutputs(config, refSystem, myenv)
+				if err != nil {
+					reasons[refSystem] = err.Error()
+				}
+				cache[refSystem] = outputs
+			}
+			if reasons[refSystem] != "" {
+				return nil, fail(reasons[refSystem])
+			}
+			out, found := cache[refSystem][name]
+			if !found {
+				return nil, fail(fmt.Sprintf("no such output in environment %s", myenv))
+			}
+			if out.Redacted {
+				return nil, fail("output is sensitive, its value is not saved by vdex output --write")
+			}
+			text, err := outputExpr(out.Value, inString(value, m[0]))
+			if err != nil {
+				return nil, fail(err.Error())
+			}
+			sb.WriteString(value[last:m[0]])
+			sb.WriteString(text)
+			last = m[1]
+		}
+		sb.WriteString(value[last:])
+		resolved[key] = sb.String()
+		log.Println(key, "resolved =>", resolved[key])
+	}
+	return resolved, nil
+}
+
+/*
+ * Renders the system into its .cache folder again if its config references the outputs of the other systems
+ * force: the system is rendered in any case (eg: its render failed before)
+ */
+func renderSystemRefs(config *cfg.Config, teamCfgPath string, myenv string, force bool) error {
+	teamCfgFile := codec.Locate(filepath.Join(teamCfgPath, config.GetConfFile(myenv)))
+	if teamCfgFile == "" {
+		return nil
+	}
+	values, err := codec.ReadFile(teamCfgFile)
+	if err != nil || (len(SystemRefs(values)) == 0 && !force) {
+		return err
+	}
+	_, err = ReadConfigFile(config, teamCfgPath, teamCfgFile)
+	return err
+}
+
+/*
+ * Returns the output value as terraform expression, or as the text of a quoted string if quoted is set
+ */
+func outputExpr(value any, quoted bool) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	// json is a terraform expression, the template sequences of the strings are escaped
+	text := strings.NewReplacer("${", "$${", "%{", "%%{").Replace(string(data))
+	if !quoted {
+		return text, nil
+	}
+	switch value.(type) {
+	case string:
+		return text[1 : len(text)-1], nil
+	case float64, bool:
+		return text, nil
+	}
+	return "", fmt.Errorf("the output is not a string, number or bool, it can not be used in a quoted string")
+}
+
+// returns true if the position i of the value is in a quoted string
+func inString(value string, i int) bool {
+	quoted := false
+	for j := 0; j < i; j++ {
+		switch value[j] {
+		case '\\':
+			j++
+		case '"':
+			quoted = !quoted
+		}
+	}
+	return quoted
+}
@@ -0,0 +1,62 @@
+package plan
+
+import (
+	"testing"
+)
+
+func TestOutputExpr(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		quoted bool
+		want   string
+		err    bool
+	}{
+		{"string", "vpc-0a12", false, `"vpc-0a12"`, false},
+		{"quoted string", "vpc-0a12", true, "vpc-0a12", false},
+		{"number", float64(3), false, "3", false},
+		{"quoted number", 1.5, true, "1.5", false},
+		{"bool", true, true, "true", false},
+		{"list", []any{"a", "b"}, false, `["a","b"]`, false},
+		{"quoted list", []any{"a"}, true, "", true},
+		{"map", map[string]any{"k": "v"}, false, `{"k":"v"}`, false},
+		{"null", nil, false, "null", false},
+		{"template sequences", "${x}-%{y}", false, `"$${x}-%%{y}"`, false},
+		{"escaped quote", `a"b`, true, `a\"b`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := outputExpr(tt.value, tt.quoted)
+			if tt.err {
+				if err == nil {
+					t.Errorf("outputExpr(%v, %v) = %q, want an error", tt.value, tt.quoted, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("outputExpr(%v, %v) = %q, %v, want %q", tt.value, tt.quoted, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInString(t *testing.T) {
+	tests := []struct {
+		value string
+		i     int
+		want  bool
+	}{
+		{`${system.a.outputs.x}`, 0, false},
+		{`"${system.a.outputs.x}"`, 1, true},
+		{`"x-${system.a.outputs.x}"`, 3, true},
+		{`["a", ${system.a.outputs.x}]`, 6, false},
+		{`"a\"b${system.a.outputs.x}"`, 5, true},
+		{`"a" + "${system.a.outputs.x}"`, 7, true},
+		{`"a" + ${system.a.outputs.x}`, 6, false},
+	}
+	for _, tt := range tests {
+		if got := inString(tt.value, tt.i); got != tt.want {
+			t.Errorf("inString(%s, %d) = %v, want %v", tt.value, tt.i, got, tt.want)
+		}
+	}
+}
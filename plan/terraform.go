@@ -0,0 +1,124 @@
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// structure runs the terraform commands in a generated folder
+type Terraform struct {
+	// terraform binary
+	App string
+	// folder the commands run in
+	Dir string
+	// variables added to the environment of vdex (eg: TF_WORKSPACE=dev)
+	Env []string
+}
+
+/*
+ * Returns the name of the terraform binary of the platform
+ */
+func TerraformApp() string {
+	if runtime.GOOS == "windows" {
+		return "terraform.exe"
+	}
+	return "terraform"
+}
+
+/*
+ * Returns Terraform running in the folder dir with the additional environment variables env
+ */
+func NewTerraform(dir string, env ...string) Terraform {
+	return Terraform{App: TerraformApp(), Dir: dir, Env: env}
+}
+
+/*
+ * Returns true if the terraform binary is found in the PATH
+ */
+func (tf Terraform) Found() bool {
+	_, err := exec.LookPath(tf.App)
+	return err == nil
+}
+
+/*
+ * Returns the terraform command with the arguments, it runs in the folder of tf
+ * The working directory and the environment of vdex are not changed
+ */
+func (tf Terraform) Command(args ...string) *exec.Cmd {
+	cmd := exec.Command(tf.App, args...)
+	cmd.Dir = tf.Dir
+	cmd.Env = append(os.Environ(), tf.Env...)
+	return cmd
+}
+
+/*
+ * Runs the terraform command with the arguments
+ * Returns
+ * the standard output of the command, it is returned on failure as well
+ * error: if the command fails, it holds the standard error of the command
+ */
+func (tf Terraform) Run(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := tf.Command(args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return out, fmt.Errorf("terraform %s failed in %s: %w", args[0], tf.Dir, err)
+		}
+		return out, fmt.Errorf("terraform %s failed in %s: %w\n%s", args[0], tf.Dir, err, msg)
+	}
+	return out, nil
+}
+
+/*
+ * Returns the workspaces of the folder of tf and the selected one
+ */
+func (tf Terraform) Workspaces() ([]string, string, error) {
+	out, err := tf.Run("workspace", "list")
+	if err != nil {
+		return nil, "", err
+	}
+	var names []string
+	current := ""
+	for _, l := range strings.Split(string(out), "\n") {
+		l = strings.TrimSpace(l)
+		// the selected workspace is marked with *, eg: * dev
+		if name, found := strings.CutPrefix(l, "*"); found {
+			l = strings.TrimSpace(name)
+			current = l
+		}
+		if l != "" {
+			names = append(names, l)
+		}
+	}
+	return names, current, nil
+}
+
+/*
+ * Returns the number of resources in the state of the workspace
+ */
+func (tf Terraform) StateCount(workspace string) (int, error) {
+	ws := tf
+	ws.Env = append(append([]string{}, tf.Env...), "TF_WORKSPACE="+workspace)
+	out, err := ws.Run("state", "list")
+	if err != nil {
+		// a workspace without state has nothing to list
+		if strings.Contains(err.Error(), "No state file was found") {
+			return 0, nil
+		}
+		return 0, err
+	}
+	n := 0
+	for _, l := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(l) != "" {
+			n++
+		}
+	}
+	return n, nil
+}
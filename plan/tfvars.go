@@ -0,0 +1,106 @@
+package plan
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"vdex/codec"
+	cfg "vdex/config"
+	parcer "vdex/parser"
+)
+
+// name of the generated file declaring the variables of the REPLACE-ME params
+const VARIABLES_FILE = "variables.tf"
+
+/*
+ * Returns the name of the variable values file of the workspace
+ */
+func TfvarsFile(workspace string) string {
+	return workspace + ".tfvars"
+}
+
+/*
+ * Returns the variable names of the schema keys
+ * error if two keys result in the same variable name
+ */
+func varNames(schema map[string]parcer.ParamValue) (map[string]string, error) {
+	names := make(map[string]string, len(schema))
+	keys := make(map[string]string, len(schema))
+	for _, k := range codec.SortKeys(schema) {
+		name := parcer.VarName(k)
+		if other, ok := keys[name]; ok {
+			return nil, fmt.Errorf("keys %s and %s result in the same variable name %s", other, k, name)
+		}
+		keys[name] = k
+		names[k] = name
+	}
+	return names, nil
+}
+
+/*
+ * Writes the variables.tf declaring a variable for each REPLACE-ME param of the template
+ * The type of the variable is inferred from the type of the template value
+ * Returns
+ * string: the generated file
+ * error: if any failure
+ */
+func WriteVariables(config *cfg.Config, mainPath string, schema map[string]parcer.ParamValue) (string, error) {
+	names, err := varNames(schema)
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	indent := strings.Repeat(" ", config.Tabsize)
+	var sb strings.Builder
+	sb.WriteString("# Generated by vdex, declares the REPLACE-ME values of the template")
+	for _, k := range codec.SortKeys(schema) {
+		fmt.Fprintf(&sb, "\n\nvariable \"%s\" {", names[k])
+		fmt.Fprintf(&sb, "\n%sdescription = %q", indent, k)
+		fmt.Fprintf(&sb, "\n%stype = %s", indent, parcer.VarType(schema[k].P_type))
+		sb.WriteString("\n}")
+	}
+	sb.WriteString("\n")
+
+	varsFile := path.Join(mainPath, VARIABLES_FILE)
+	if err := os.WriteFile(varsFile, []byte(sb.String()), 0666); err != nil {
+		log.Println("Failed to write file:", varsFile)
+		return varsFile, err
+	}
+	return varsFile, nil
+}
+
+/*
+ * Writes the <workspace>.tfvars with the configured values of the REPLACE-ME params
+ * Template value is used for the params missing in the config
+ * Returns
+ * string: the generated file
+ * error: if any failure
+ */
+func WriteTfvars(mainPath string, workspace string, schema map[string]parcer.ParamValue, userConfig map[string]string) (string, error) {
+	names, err := varNames(schema)
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Generated by vdex from the config of the environment " + workspace)
+	for _, k := range codec.SortKeys(schema) {
+		value, ok := userConfig[k]
+		if !ok {
+			value = schema[k].P_value
+		}
+		fmt.Fprintf(&sb, "\n%s = %s", names[k], value)
+	}
+	sb.WriteString("\n")
+
+	tfvarsFile := path.Join(mainPath, TfvarsFile(workspace))
+	if err := os.WriteFile(tfvarsFile, []byte(sb.String()), 0666); err != nil {
+		log.Println("Failed to write file:", tfvarsFile)
+		return tfvarsFile, err
+	}
+	return tfvarsFile, nil
+}
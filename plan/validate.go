@@ -0,0 +1,334 @@
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"vdex/codec"
+	cfg "vdex/config"
+	"vdex/parser"
+	"vdex/template"
+)
+
+// folder of a system validate renders into and runs terraform in (eg: src/sys1/.cache-validate)
+const VALIDATE_PATH = ".cache-validate"
+
+// output of terraform validate -json
+type tfValidateOutput struct {
+	Valid       bool           `json:"valid"`
+	Diagnostics []tfDiagnostic `json:"diagnostics"`
+}
+
+// diagnostic of terraform validate -json
+type tfDiagnostic struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail"`
+	Range    *struct {
+		Filename string `json:"filename"`
+		Start    struct {
+			Line   int `json:"line"`
+			Column int `json:"column"`
+		} `json:"start"`
+	} `json:"range"`
+}
+
+// structure holds the result of validate
+type ValidateReport struct {
+	// number of the validated systems
+	Systems int `json:"systems" yaml:"systems"`
+	// number of the errors and the warnings
+	Errors   int `json:"errors" yaml:"errors"`
+	Warnings int `json:"warnings" yaml:"warnings"`
+	// problems found
+	Diagnostics parser.Diagnostics `json:"diagnostics" yaml:"diagnostics"`
+}
+
+// lines of a config value in a rendered file
+type valueSpan struct {
+	start int
+	end   int
+	// config key of the value
+	key string
+}
+
+/*
+ * Validates the config files of the environment without accessing the backend
+ * - the values of each config are checked against the REPLACE-ME params of the template
+ * - the systems are rendered into their .cache-validate folder, the .cache folder is not changed
+ * - terraform init -backend=false and terraform validate run in each .cache-validate folder
+ * Problems terraform finds on a rendered value are reported with the key and the line of the config
+ * system: validates only the named system if set
+ * skipTerraform: only the config is checked and rendered
+ * Returns
+ * the report with the diagnostics of all the systems
+ * error: if the validation could not run
+ */
+func VdexValidate(config *cfg.Config, myenv string, system string, skipTerraform bool) (*ValidateReport, error) {
+	log.Printf("\nIn VdexValidate")
+
+	if err := checkSystem(config, system); err != nil {
+		return nil, err
+	}
+	systems, err := systemConfigs(config, myenv, system)
+	if err != nil {
+		return nil, err
+	}
+
+	diags := parser.Diagnostics{}
+	if !skipTerraform && len(systems) > 0 && !NewTerraform("").Found() {
+		diags = append(diags, parser.Diagnostic{Severity: parser.SEV_WARNING, File: TerraformApp(),
+			Message: "terraform binary is not found, terraform validate is skipped"})
+		skipTerraform = true
+	}
+	for _, sc := range systems {
+		diags = append(diags, validateSystem(config, sc, skipTerraform)...)
+	}
+	report := &ValidateReport{Systems: len(systems), Diagnostics: diags}
+	for _, d := range diags {
+		if d.Severity == parser.SEV_ERROR {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+	return report, nil
+}
+
+/*
+ * Validates the config file of the system, see VdexValidate
+ */
+func validateSystem(config *cfg.Config, sc systemConfig, skipTerraform bool) parser.Diagnostics {
+	var diags parser.Diagnostics
+	fail := func(file string, format string, a ...any) parser.Diagnostics {
+		return append(diags, parser.Diagnostic{Severity: parser.SEV_ERROR, File: file, Message: fmt.Sprintf(format, a...)})
+	}
+
+	data, err := os.ReadFile(sc.File)
+	if err != nil {
+		return fail(sc.File, "%v", err)
+	}
+	userConfig, err := codec.ReadFile(sc.File)
+	if err != nil {
+		return fail(sc.File, "%v", err)
+	}
+
+	// the .cache folder is left as it is, terraform init -backend=false would drop its backend
+	mainPath := filepath.Join(sc.Path, VALIDATE_PATH)
+	var tfbs *parser.TFBlocks
+	fileList, err := renderStagedTo(sc.Path, mainPath, func(stagePath string) ([]string, error) {
+		var files []string
+		var err error
+		tfbs, files, err = renderConfig(config, sc.Path, sc.File, userConfig, stagePath)
+		return files, err
+	})
+	var tdiags parser.Diagnostics
+	if errors.As(err, &tdiags) {
+		return append(diags, tdiags...)
+	} else if err != nil {
+		return fail(sc.File, "render failed: %v", err)
+	}
+
+	diags = append(diags, checkValues(sc.File, data, tfbs.Schema, userConfig)...)
+	for _, w := range template.ReferenceWarnings(tfbs, userConfig) {
+		diags = append(diags, parser.Diagnostic{Severity: parser.SEV_WARNING, File: sc.File, Message: w})
+	}
+	if skipTerraform {
+		return diags
+	}
+
+	tf := NewTerraform(mainPath, "TF_IN_AUTOMATION=1")
+	if _, err := tf.Run("init", "-backend=false", "-input=false", "-no-color"); err != nil {
+		return fail(mainPath, "%v", err)
+	}
+	out, err := tf.Run("validate", "-json", "-no-color")
+	var result tfValidateOutput
+	if jerr := json.Unmarshal(out, &result); jerr != nil {
+		if err != nil {
+			return fail(mainPath, "%v", err)
+		}
+		return fail(mainPath, "failed to read the output of terraform validate: %v", jerr)
+	}
+
+	spans := make(map[string][]valueSpan)
+	for _, f := range fileList {
+		if rel, err := filepath.Rel(mainPath, f); err == nil && filepath.Ext(f) == ".tf" {
+			spans[filepath.ToSlash(rel)] = valueSpans(f, filepath.ToSlash(rel), tfbs.Schema)
+		}
+	}
+	for _, td := range result.Diagnostics {
+		diags = append(diags, terraformDiagnostic(td, mainPath, spans, sc.File, data))
+	}
+	return diags
+}
+
+/*
+ * Converts the diagnostic of terraform validate, the key and the line of the config
+ * are added to the message when the diagnostic is on a rendered value
+ */
+func terraformDiagnostic(td tfDiagnostic, mainPath string, spans map[string][]valueSpan, cfgFile string, cfgData []byte) parser.Diagnostic {
+	d := parser.Diagnostic{Severity: parser.SEV_ERROR, File: mainPath, Message: td.Summary}
+	if td.Severity == "warning" {
+		d.Severity = parser.SEV_WARNING
+	}
+	if td.Detail != "" {
+		d.Message += ": " + strings.SplitN(td.Detail, "\n", 2)[0]
+	}
+	if td.Range == nil {
+		return d
+	}
+
+	name := filepath.ToSlash(td.Range.Filename)
+	d.File = filepath.Join(mainPath, filepath.FromSlash(name))
+	d.Line, d.Column = td.Range.Start.Line, td.Range.Start.Column
+	if text, err := os.ReadFile(d.File); err == nil {
+		if lines := strings.Split(string(text), "\n"); d.Line > 0 && d.Line <= len(lines) {
+			d.Snippet = lines[d.Line-1]
+		}
+	}
+	for _, s := range spans[name] {
+		if d.Line >= s.start && d.Line <= s.end {
+			if line := keyLine(cfgData, s.key); line > 0 {
+				d.Message += fmt.Sprintf(" (value of %s at %s:%d)", s.key, cfgFile, line)
+			} else {
+				d.Message += fmt.Sprintf(" (value of %s in %s)", s.key, cfgFile)
+			}
+			break
+		}
+	}
+	return d
+}
+
+/*
+ * Returns the lines of the config values in the rendered file
+ * rel is the name of the file in the template, it qualifies the keys found in more than one file
+ */
+func valueSpans(file string, rel string, schema map[string]parser.ParamValue) []valueSpan {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	doc, err := parser.Parse(f, file)
+	if err != nil {
+		log.Println("Failed to parse the rendered file", file, err)
+		return nil
+	}
+
+	// returns the config key of the param key, empty string if it is not a config value
+	configKey := func(key string) string {
+		if _, found := schema[rel+template.FILE_KEY_SEP+key]; found {
+			return rel + template.FILE_KEY_SEP + key
+		} else if _, found := schema[key]; found {
+			return key
+		}
+		return ""
+	}
+
+	var spans []valueSpan
+	var walk func(b *parser.TFBlock, value string)
+	walk = func(b *parser.TFBlock, value string) {
+		// a map value opened with "{" alone on the line is parsed as a sub block
+		if value == "" {
+			value = configKey(b.BlockfName)
+		}
+		for k, p := range b.Params {
+			key := value
+			if key == "" {
+				key = configKey(b.BlockfName + "." + k)
+			}
+			if key != "" {
+				spans = append(spans, valueSpan{start: p.P_line, end: p.P_endline, key: key})
+			}
+		}
+		for _, c := range b.Child {
+			walk(c, value)
+		}
+	}
+	for i := range doc.Blocks {
+		walk(&doc.Blocks[i], "")
+	}
+	return spans
+}
+
+/*
+ * Checks the values of the config against the REPLACE-ME params of the template
+ * data is the content of the config file, it gives the line of the keys
+ */
+func checkValues(cfgFile string, data []byte, schema map[string]parser.ParamValue, values map[string]string) parser.Diagnostics {
+	var diags parser.Diagnostics
+	report := func(sev parser.Severity, key string, format string, a ...any) {
+		diags = append(diags, parser.Diagnostic{Severity: sev, File: cfgFile, Line: keyLine(data, key), Column: 1,
+			Message: fmt.Sprintf(format, a...)})
+	}
+
+	for _, k := range codec.SortKeys(schema) {
+		p := schema[k]
+		v, found := values[k]
+		if !found {
+			if p.P_value == parser.REPLACE2 {
+				report(parser.SEV_ERROR, k, "%s has no value", k)
+			} else {
+				report(parser.SEV_WARNING, k, "%s has no value, the template value %s is used", k, p.P_value)
+			}
+			continue
+		}
+		if v == parser.REPLACE2 {
+			report(parser.SEV_ERROR, k, "%s is not set, the value is %s", k, v)
+			continue
+		}
+		if problem := valueProblem(v); problem != "" {
+			report(parser.SEV_ERROR, k, "%s: %s", k, problem)
+			continue
+		}
+		if p.P_value != parser.REPLACE2 {
+			got, want := parser.TypeName(parser.ValueType(v)), parser.TypeName(p.P_type)
+			if got != "" && want != "" && got != want {
+				report(parser.SEV_WARNING, k, "%s is a %s, the template has a %s", k, got, want)
+			}
+		}
+	}
+
+	for _, k := range codec.SortKeys(values) {
+		if _, found := schema[k]; !found && !codec.IsSetting(k) {
+			report(parser.SEV_WARNING, k, "%s is not a REPLACE-ME value of the template", k)
+		}
+	}
+	return diags
+}
+
+// returns the problem of the value text, empty string if it is a complete expression
+func valueProblem(value string) string {
+	lines := strings.Split(value, "\n")
+	i := 0
+	expr := parser.ScanExpr(lines[0], func() (string, bool) {
+		i++
+		if i < len(lines) {
+			return lines[i], true
+		}
+		return "", false
+	})
+	return expr.Problem
+}
+
+/*
+ * Returns the line (starts from 1) of the key in the config file, 0 if it is not found
+ * the key may be quoted as in the json and yaml formats
+ */
+func keyLine(data []byte, key string) int {
+	forms := []string{key, strconv.Quote(key), "'" + strings.ReplaceAll(key, "'", "''") + "'"}
+	for i, l := range strings.Split(string(data), "\n") {
+		l = strings.TrimSpace(l)
+		for _, k := range forms {
+			if rest, ok := strings.CutPrefix(l, k); ok && (rest == "" || strings.ContainsAny(rest[:1], " \t=:")) {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,221 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	cfg "vdex/config"
+	"vdex/history"
+)
+
+// folder of the project holding the snapshots (eg: .vdex/snapshots/sys1/prod/20240502-101502)
+const SNAPSHOT_PATH = "snapshots"
+
+// content of a snapshot folder
+const (
+	// description of the snapshot
+	META_FILE = "snapshot.json"
+	// copy of the config file
+	CONFIG_DIR = "config"
+	// copy of the rendered .cache files
+	FILES_DIR = "files"
+)
+
+// IDs to select the last two snapshots
+const (
+	ID_LATEST   = "latest"
+	ID_PREVIOUS = "previous"
+)
+
+// structure holds a snapshot of the config and the rendered files taken after a successful apply
+type Snapshot struct {
+	// unique within the system and environment, from the time of the apply (eg: 20240502-101502)
+	ID string `json:"id" yaml:"id"`
+	// the apply the snapshot was taken after
+	history.Entry `yaml:",inline"`
+	// folder of the snapshot
+	Dir string `json:"-" yaml:"-"`
+}
+
+/*
+ * Returns the folder of the snapshots of the system and environment
+ */
+func Dir(config *cfg.Config, system string, myenv string) string {
+	return filepath.Join(config.ProjectPath, SNAPSHOT_PATH, system, myenv)
+}
+
+/*
+ * Returns the path of the copy of the config file
+ */
+func (s *Snapshot) ConfigPath() string {
+	return filepath.Join(s.Dir, CONFIG_DIR, filepath.Base(s.ConfigFile))
+}
+
+/*
+ * Returns the folder of the copy of the rendered files
+ */
+func (s *Snapshot) FilesDir() string {
+	return filepath.Join(s.Dir, FILES_DIR)
+}
+
+/*
+ * Takes a snapshot of the config file and the rendered files of cacheDir after the apply of the entry
+ * the working files of terraform (.terraform folder, local state) are not copied
+ * Returns the new snapshot
+ */
+func Create(config *cfg.Config, entry history.Entry, cacheDir string) (*Snapshot, error) {
+	if entry.ConfigFile == "" {
+		return nil, fmt.Errorf("config file of %s is not known", entry.System)
+	}
+	base := Dir(config, entry.System, entry.Environment)
+	id := entry.Time.UTC().Format("20060102-150405")
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(base, id)); os.IsNotExist(err) {
+			break
+		}
+		id = entry.Time.UTC().Format("20060102-150405") + "-" + strconv.Itoa(n)
+	}
+
+	snap := &Snapshot{ID: id, Entry: entry, Dir: filepath.Join(base, id)}
+	if err := os.MkdirAll(filepath.Join(snap.Dir, CONFIG_DIR), 0755); err != nil {
+		return nil, err
+	}
+	if err := copyFile(entry.ConfigFile, snap.ConfigPath()); err != nil {
+		return nil, err
+	}
+	if err := copyTree(cacheDir, snap.FilesDir()); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// the description is written last, a folder without it is not a snapshot
+	if err := os.WriteFile(filepath.Join(snap.Dir, META_FILE), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+/*
+ * Returns the snapshots of the system and environment, oldest first
+ */
+func List(config *cfg.Config, system string, myenv string) ([]Snapshot, error) {
+	base := Dir(config, system, myenv)
+	entries, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return []Snapshot{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	snaps := []Snapshot{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(base, e.Name(), META_FILE))
+		if err != nil {
+			continue
+		}
+		var s Snapshot
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(base, e.Name(), META_FILE), err)
+		}
+		s.Dir = filepath.Join(base, e.Name())
+		snaps = append(snaps, s)
+	}
+	sort.SliceStable(snaps, func(i, j int) bool {
+		return snaps[i].Time.Before(snaps[j].Time)
+	})
+	return snaps, nil
+}
+
+/*
+ * Returns the snapshot of the system and environment with the id
+ * latest is the snapshot of the last apply and previous the one before it
+ */
+func Find(config *cfg.Config, system string, myenv string, id string) (*Snapshot, error) {
+	snaps, err := List(config, system, myenv)
+	if err != nil {
+		return nil, err
+	}
+	switch id {
+	case ID_LATEST:
+		if len(snaps) > 0 {
+			return &snaps[len(snaps)-1], nil
+		}
+		return nil, fmt.Errorf("no snapshot of %s in environment %s, snapshots are taken by apply", system, myenv)
+	case ID_PREVIOUS:
+		if len(snaps) > 1 {
+			return &snaps[len(snaps)-2], nil
+		}
+		return nil, fmt.Errorf("no snapshot before the latest apply of %s in environment %s", system, myenv)
+	}
+	for i := range snaps {
+		if snaps[i].ID == id {
+			return &snaps[i], nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot %s of %s in environment %s not found", id, system, myenv)
+}
+
+// returns true if the file is a working file of terraform, it is not part of a snapshot
+func isWorkFile(d fs.DirEntry) bool {
+	name := d.Name()
+	if d.IsDir() {
+		return name == ".terraform"
+	}
+	return strings.HasPrefix(name, "terraform.tfstate") || strings.HasSuffix(name, ".tfplan")
+}
+
+// copies the files of the folder src into dst
+func copyTree(src string, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." && isWorkFile(d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+		return copyFile(p, filepath.Join(dst, rel))
+	})
+}
+
+// copies the file, parent directories are created if needed
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,220 @@
+package template
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	cfg "vdex/config"
+	parcer "vdex/parser"
+)
+
+// structure holds a validation rule of a module variable
+type Validation struct {
+	Condition    string
+	ErrorMessage string
+}
+
+// structure holds an input variable of a module
+type Variable struct {
+	// name of the variable
+	Name string
+	// type constraint, empty if not set
+	Type string
+	// default value, valid only if HasDefault is set
+	Default    string
+	HasDefault bool
+	// description without the quotes
+	Description string
+	// validation rules
+	Validations []Validation
+}
+
+// returns the text of a quoted string without the quotes
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return strings.Trim(s, "\"")
+}
+
+// returns the name of the block - variable "foo" => foo
+func labelOf(blockName string) string {
+	fields := strings.Fields(blockName)
+	if len(fields) < 2 {
+		return ""
+	}
+	return unquote(fields[1])
+}
+
+// formats the map/object block as a single line terraform object
+func inlineBlock(b *parcer.TFBlock) string {
+	var items []string
+	keys := make([]string, 0, len(b.Params))
+	for k := range b.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		items = append(items, k+" = "+b.Params[k].P_value)
+	}
+	for _, c := range b.Child {
+		items = append(items, c.BlockName+" = "+inlineBlock(c))
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
+}
+
+/*
+ * Parses the terraform files of the module folder and returns the input variables
+ * in the order they are declared
+ */
+func ModuleVariables(config *cfg.Config, moduleDir string) ([]Variable, error) {
+	var vars []Variable
+
+	info, err := os.Stat(moduleDir)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("module %s is not a folder", moduleDir)
+	}
+	tmpl, err := Load(config, moduleDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range tmpl.Files {
+		// variables of the nested modules are not inputs of the module
+		if strings.Contains(f, "/") {
+			continue
+		}
+		doc, err := parseFile(filepath.Join(tmpl.Root, f))
+		if err != nil {
+			log.Println("Failed to parse file:", f)
+			return nil, err
+		}
+		for i := range doc.Blocks {
+			b := &doc.Blocks[i]
+			if !strings.HasPrefix(b.BlockName, "variable") {
+				continue
+			}
+			v := Variable{Name: labelOf(b.BlockName)}
+			if p, ok := b.Params["type"]; ok {
+				v.Type = p.P_value
+			}
+			if p, ok := b.Params["description"]; ok {
+				v.Description = unquote(p.P_value)
+			}
+			if p, ok := b.Params["default"]; ok {
+				v.Default = p.P_value
+				v.HasDefault = true
+			}
+			for _, c := range b.Child {
+				switch c.BlockName {
+				case "default":
+					v.Default = inlineBlock(c)
+					v.HasDefault = true
+				case "validation":
+					v.Validations = append(v.Validations, Validation{
+						Condition:    c.Params["condition"].P_value,
+						ErrorMessage: unquote(c.Params["error_message"].P_value),
+					})
+				}
+			}
+			vars = append(vars, v)
+		}
+	}
+	return vars, nil
+}
+
+// returns a name usable as terraform block label
+func moduleName(moduleDir string) string {
+	name := parcer.VarName(filepath.Base(filepath.Clean(moduleDir)))
+	if name == "v_" {
+		return "main"
+	}
+	return name
+}
+
+/*
+ * Generates a starter template calling the module with every input wired up
+ * Inputs without default are REPLACE-ME values, optional inputs are set to their default
+ * (all: optional inputs are REPLACE-ME values too with the default offered)
+ * Returns the content of the template
+ */
+func NewFromModule(config *cfg.Config, moduleDir string, name string, outFile string, all bool) ([]byte, error) {
+	vars, err := ModuleVariables(config, moduleDir)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = moduleName(moduleDir)
+	}
+
+	// source is relative to the generated template
+	outDir := "."
+	if outFile != "" && outFile != "-" {
+		outDir = filepath.Dir(outFile)
+	}
+	source, err := filepath.Rel(outDir, moduleDir)
+	if err != nil {
+		source = moduleDir
+	}
+	source = filepath.ToSlash(source)
+	if !strings.HasPrefix(source, "../") && !filepath.IsAbs(source) {
+		source = "./" + source
+	}
+
+	indent := strings.Repeat(" ", config.Tabsize)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// Generated by vdex from the module %s", filepath.ToSlash(moduleDir))
+	fmt.Fprintf(&sb, "\nmodule %q {", name)
+	fmt.Fprintf(&sb, "\n%ssource = %q", indent, source)
+	for _, v := range vars {
+		sb.WriteString("\n")
+		if v.Description != "" {
+			fmt.Fprintf(&sb, "\n%s// %s", indent, strings.ReplaceAll(v.Description, "\n", " "))
+		}
+		if v.Type != "" {
+			fmt.Fprintf(&sb, "\n%s// type: %s", indent, strings.ReplaceAll(v.Type, "\n", " "))
+		}
+		for _, val := range v.Validations {
+			fmt.Fprintf(&sb, "\n%s// validation: %s (%s)", indent, strings.ReplaceAll(val.Condition, "\n", " "), val.ErrorMessage)
+		}
+		switch {
+		case !v.HasDefault:
+			fmt.Fprintf(&sb, "\n%s// required input\n%s%s = %s", indent, indent, v.Name, parcer.REPLACE2)
+		case all:
+			fmt.Fprintf(&sb, "\n%s%s = %s // %s", indent, v.Name, v.Default, parcer.REPLACE)
+		default:
+			fmt.Fprintf(&sb, "\n%s%s = %s", indent, v.Name, v.Default)
+		}
+	}
+	sb.WriteString("\n}\n")
+	return []byte(sb.String()), nil
+}
+
+/*
+ * Writes the starter template of the module to outFile ("-" for stdout)
+ * An existing file is overwritten only if force is set
+ */
+func VdexTemplateNew(config *cfg.Config, moduleDir string, name string, outFile string, all bool, force bool) error {
+	log.Printf("\nIn VdexTemplateNew %s", moduleDir)
+	data, err := NewFromModule(config, moduleDir, name, outFile, all)
+	if err != nil {
+		return err
+	}
+	if outFile == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if _, err := os.Stat(outFile); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite", outFile)
+	}
+	if dir := filepath.Dir(outFile); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(outFile, data, 0666)
+}
@@ -0,0 +1,426 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	cfg "vdex/config"
+)
+
+// prefixes of the remote template sources
+const (
+	GIT_PREFIX      = "git::"
+	REGISTRY_PREFIX = "registry::"
+)
+
+// folder under the project path where the remote templates are cached
+const CACHE_DIR = "templates"
+
+// file of the cache folder holding the newest versions found by Latest, by source
+const LATEST_FILE = "latest.json"
+
+const (
+	// a git source that is not pinned to a version or a commit is fetched again after
+	REFRESH_AFTER = time.Hour
+	// the tags of a git source are listed again after
+	LATEST_CHECK_AFTER = 24 * time.Hour
+)
+
+// commit id of a git ref, eg: 3f2a9c1
+var commitID = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// structure holds a remote template source after it is fetched
+type Resolved struct {
+	// source as configured
+	Source string
+	// local folder holding the template files
+	Dir string
+	// commit of the git source
+	Commit string
+	// pinned ref (git) or version (registry), empty if not pinned
+	Ref string
+	// checksum of the template files
+	Checksum string
+	// time the git source was fetched
+	Fetched time.Time `json:",omitempty"`
+}
+
+// structure of a git source git::<url>[//<subdir>][?ref=<ref>]
+type gitSource struct {
+	url    string
+	subdir string
+	ref    string
+}
+
+/*
+ * Returns true if the source is a git or registry source
+ */
+func IsRemote(source string) bool {
+	return strings.HasPrefix(source, GIT_PREFIX) || strings.HasPrefix(source, REGISTRY_PREFIX)
+}
+
+// parses git::file:///path/repo//templates/app?ref=v1.4.0
+func parseGitSource(source string) gitSource {
+	var gs gitSource
+	s := strings.TrimPrefix(source, GIT_PREFIX)
+	if idx := strings.Index(s, "?"); idx >= 0 {
+		for _, q := range strings.Split(s[idx+1:], "&") {
+			if strings.HasPrefix(q, "ref=") {
+				gs.ref = strings.TrimPrefix(q, "ref=")
+			}
+		}
+		s = s[:idx]
+	}
+	start := 0
+	if idx := strings.Index(s, "://"); idx >= 0 {
+		start = idx + 3
+	}
+	if idx := strings.Index(s[start:], "//"); idx >= 0 {
+		gs.subdir = s[start+idx+2:]
+		s = s[:start+idx]
+	}
+	gs.url = s
+	return gs
+}
+
+// parses registry::<name>[@<version>]
+func parseRegistrySource(source string) (string, string) {
+	s := strings.TrimPrefix(source, REGISTRY_PREFIX)
+	if idx := strings.LastIndex(s, "@"); idx >= 0 {
+		return s[:idx], s[idx+1:]
+	}
+	return s, ""
+}
+
+// returns the cache folder of the source
+func cacheDir(config *cfg.Config, source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return filepath.Join(config.ProjectPath, CACHE_DIR, hex.EncodeToString(sum[:])[:16])
+}
+
+// returns true if the git ref always names the same commit, a version tag or a commit id
+// sources without a ref or with a branch are fetched again after REFRESH_AFTER
+func isPinned(ref string) bool {
+	return parseVersion(ref) != nil || commitID.MatchString(ref)
+}
+
+// runs git and returns the trimmed output
+func git(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+/*
+ * Returns the checksum of the files of the folder (sha256 of the relative paths and the contents)
+ */
+func Checksum(dir string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return checksumFiles(dir, files)
+}
+
+/*
+ * Returns the checksum of the files (relative to dir, slash separated)
+ */
+func checksumFiles(dir string, files []string) (string, error) {
+	files = append([]string(nil), files...)
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\n%d\n", f, len(data))
+		h.Write(data)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+/*
+ * Resolves the remote source to a local folder, git sources are fetched into the cache
+ * .vdex/templates/<hash> and reused afterwards, the sources that are not pinned are fetched again after REFRESH_AFTER
+ * Returns the resolved source
+ */
+func Resolve(config *cfg.Config, source string) (*Resolved, error) {
+	if strings.HasPrefix(source, REGISTRY_PREFIX) {
+		return resolveRegistry(config, source)
+	}
+	return resolveGit(config, source)
+}
+
+func resolveRegistry(config *cfg.Config, source string) (*Resolved, error) {
+	if config.Registry == "" {
+		return nil, fmt.Errorf("%s needs the %s setting in the project config", source, cfg.REGISTRY_KEY)
+	}
+	name, version := parseRegistrySource(source)
+	r := Resolved{Source: source, Ref: version}
+	if version == "" {
+		versions, err := registryVersions(config, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("no versions of %s found in the registry %s", name, config.Registry)
+		}
+		version = versions[len(versions)-1]
+	}
+	r.Dir = filepath.Join(config.Registry, name, version)
+	if info, err := os.Stat(r.Dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("version %s of %s not found in the registry %s", version, name, config.Registry)
+	}
+	var err error
+	r.Checksum, err = Checksum(r.Dir)
+	return &r, err
+}
+
+// returns the versions of the registry module, oldest first
+func registryVersions(config *cfg.Config, name string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(config.Registry, name))
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, e := range entries {
+		if e.IsDir() {
+			versions = append(versions, e.Name())
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) < 0
+	})
+	return versions, nil
+}
+
+func resolveGit(config *cfg.Config, source string) (*Resolved, error) {
+	gs := parseGitSource(source)
+	// a ref or a url starting with - would be taken as an option by git
+	if strings.HasPrefix(gs.ref, "-") {
+		return nil, fmt.Errorf("invalid ref %q in the template source %s", gs.ref, source)
+	}
+	dir := cacheDir(config, source)
+	metaFile := filepath.Join(dir, "source.json")
+	filesDir := filepath.Join(dir, "files")
+
+	// reuse the cached template
+	if data, err := os.ReadFile(metaFile); err == nil {
+		var r Resolved
+		err := json.Unmarshal(data, &r)
+		if err == nil && r.Source == source && (isPinned(gs.ref) || time.Since(r.Fetched) < REFRESH_AFTER) {
+			r.Dir = filepath.Join(filesDir, filepath.FromSlash(gs.subdir))
+			r.Checksum, err = Checksum(r.Dir)
+			return &r, err
+		}
+	}
+
+	log.Println("Fetching template", source)
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".fetch-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	repo := filepath.Join(tmp, "files")
+	if _, err := git("clone", "--quiet", "--", gs.url, repo); err != nil {
+		return nil, err
+	}
+	if gs.ref != "" {
+		if _, err := git("-C", repo, "checkout", "--quiet", gs.ref); err != nil {
+			return nil, err
+		}
+	}
+	r := Resolved{Source: source, Ref: gs.ref, Fetched: time.Now().UTC()}
+	if r.Commit, err = git("-C", repo, "rev-parse", "HEAD"); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(filepath.Join(repo, ".git")); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "source.json"), data, 0644); err != nil {
+		return nil, err
+	}
+	os.RemoveAll(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, err
+	}
+
+	r.Dir = filepath.Join(filesDir, filepath.FromSlash(gs.subdir))
+	if info, err := os.Stat(r.Dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("folder %s not found in %s", gs.subdir, gs.url)
+	}
+	r.Checksum, err = Checksum(r.Dir)
+	return &r, err
+}
+
+/*
+ * Returns the newest version available for the source if it is newer than the pinned version
+ * the tags of a git source are listed once per LATEST_CHECK_AFTER, the result is kept in .vdex/templates/latest.json
+ * Returns empty string if the source is not pinned or up to date
+ */
+func Latest(config *cfg.Config, source string) (string, error) {
+	var pinned string
+	var versions []string
+
+	if strings.HasPrefix(source, REGISTRY_PREFIX) {
+		var name string
+		name, pinned = parseRegistrySource(source)
+		if pinned == "" || config.Registry == "" {
+			return "", nil
+		}
+		var err error
+		if versions, err = registryVersions(config, name); err != nil {
+			return "", err
+		}
+	} else {
+		gs := parseGitSource(source)
+		pinned = gs.ref
+		if pinned == "" || parseVersion(pinned) == nil {
+			return "", nil
+		}
+		var err error
+		if versions, err = gitTags(config, gs.url); err != nil {
+			return "", err
+		}
+	}
+
+	latest := ""
+	for _, v := range versions {
+		if parseVersion(v) == nil {
+			continue
+		}
+		if latest == "" || compareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+	if latest != "" && compareVersions(latest, pinned) > 0 {
+		return latest, nil
+	}
+	return "", nil
+}
+
+// tags of a git repository listed by Latest
+type latestCheck struct {
+	Checked time.Time `json:"checked"`
+	Tags    []string  `json:"tags"`
+}
+
+// returns the tags of the git repository, listed by git ls-remote at most once per LATEST_CHECK_AFTER
+func gitTags(config *cfg.Config, url string) ([]string, error) {
+	file := filepath.Join(config.ProjectPath, CACHE_DIR, LATEST_FILE)
+	checks := make(map[string]latestCheck)
+	if data, err := os.ReadFile(file); err == nil {
+		if err := json.Unmarshal(data, &checks); err != nil {
+			log.Println("Ignoring", file, err)
+		}
+	}
+	if c, found := checks[url]; found && time.Since(c.Checked) < LATEST_CHECK_AFTER {
+		return c.Tags, nil
+	}
+
+	out, err := git("ls-remote", "--tags", "--", url)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasSuffix(fields[1], "^{}") {
+			continue
+		}
+		tags = append(tags, strings.TrimPrefix(fields[1], "refs/tags/"))
+	}
+
+	checks[url] = latestCheck{Checked: time.Now().UTC(), Tags: tags}
+	data, err := json.MarshalIndent(checks, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(file, data, 0644)
+	}
+	if err != nil {
+		// the tags are listed again next time
+		log.Println("Failed to save", file, err)
+	}
+	return tags, nil
+}
+
+// parses v1.4.0 or 1.4.0 into the numbers, nil if not a version
+func parseVersion(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	if v == "" {
+		return nil
+	}
+	var nums []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil
+		}
+		nums = append(nums, n)
+	}
+	return nums
+}
+
+// compares the versions, non version strings are compared as text
+func compareVersions(a string, b string) int {
+	va, vb := parseVersion(a), parseVersion(b)
+	if va == nil || vb == nil {
+		return strings.Compare(a, b)
+	}
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		x, y := 0, 0
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package template
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	cfg "vdex/config"
+)
+
+func TestParseGitSource(t *testing.T) {
+	tests := []struct {
+		source string
+		want   gitSource
+	}{
+		{"git::https://github.com/org/templates.git", gitSource{url: "https://github.com/org/templates.git"}},
+		{"git::https://github.com/org/templates.git?ref=v1.4.0", gitSource{url: "https://github.com/org/templates.git", ref: "v1.4.0"}},
+		{"git::https://github.com/org/templates.git//app", gitSource{url: "https://github.com/org/templates.git", subdir: "app"}},
+		{"git::file:///srv/git/templates//modules/x?ref=v1.1.0", gitSource{url: "file:///srv/git/templates", subdir: "modules/x", ref: "v1.1.0"}},
+		{"git::ssh://git@host/templates.git//app?depth=1&ref=3f2a9c1", gitSource{url: "ssh://git@host/templates.git", subdir: "app", ref: "3f2a9c1"}},
+		{"git::git@github.com:org/templates.git//app?ref=main", gitSource{url: "git@github.com:org/templates.git", subdir: "app", ref: "main"}},
+	}
+	for _, tt := range tests {
+		if got := parseGitSource(tt.source); got != tt.want {
+			t.Errorf("parseGitSource(%s) = %+v, want %+v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestParseRegistrySource(t *testing.T) {
+	tests := []struct {
+		source  string
+		name    string
+		version string
+	}{
+		{"registry::app", "app", ""},
+		{"registry::app@1.2.0", "app", "1.2.0"},
+		{"registry::team/app@v2.0.1", "team/app", "v2.0.1"},
+	}
+	for _, tt := range tests {
+		name, version := parseRegistrySource(tt.source)
+		if name != tt.name || version != tt.version {
+			t.Errorf("parseRegistrySource(%s) = %s, %s, want %s, %s", tt.source, name, version, tt.name, tt.version)
+		}
+	}
+}
+
+func TestIsPinned(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"", false},
+		{"main", false},
+		{"v1.4.0", true},
+		{"1.4", true},
+		{"3f2a9c1", true},
+		{"feature/v1", false},
+	}
+	for _, tt := range tests {
+		if got := isPinned(tt.ref); got != tt.want {
+			t.Errorf("isPinned(%q) = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.4.0", "v1.4.0", 0},
+		{"v1.10.0", "v1.9.0", 1},
+		{"1.2", "1.2.1", -1},
+		{"v2.0.0", "1.9.9", 1},
+		{"main", "v1.0.0", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestResolveRegistry(t *testing.T) {
+	registry := t.TempDir()
+	for _, v := range []string{"1.2.0", "1.10.0", "1.9.0"} {
+		writeFiles(t, filepath.Join(registry, "app", v), map[string]string{"main.tf": "# " + v})
+	}
+	config := &cfg.Config{ProjectPath: t.TempDir(), Registry: registry}
+
+	tests := []struct {
+		source string
+		dir    string
+		latest string
+	}{
+		{"registry::app@1.2.0", "1.2.0", "1.10.0"},
+		{"registry::app@1.10.0", "1.10.0", ""},
+		{"registry::app", "1.10.0", ""},
+	}
+	for _, tt := range tests {
+		r, err := Resolve(config, tt.source)
+		if err != nil {
+			t.Fatalf("Resolve(%s) error = %v", tt.source, err)
+		}
+		if want := filepath.Join(registry, "app", tt.dir); r.Dir != want {
+			t.Errorf("Resolve(%s) dir = %s, want %s", tt.source, r.Dir, want)
+		}
+		if latest, err := Latest(config, tt.source); err != nil || latest != tt.latest {
+			t.Errorf("Latest(%s) = %q, %v, want %q", tt.source, latest, err, tt.latest)
+		}
+	}
+	if _, err := Resolve(config, "registry::app@2.0.0"); err == nil {
+		t.Error("Resolve of a missing version is not an error")
+	}
+}
+
+func TestResolveGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=vdex", "-c", "user.email=vdex@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	run("init", "--quiet")
+	writeFiles(t, repo, map[string]string{"modules/x/main.tf": "# v1.1.0", "README.md": "templates"})
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "v1.1.0")
+	run("tag", "v1.1.0")
+	writeFiles(t, repo, map[string]string{"modules/x/main.tf": "# v1.2.0"})
+	run("commit", "--quiet", "-am", "v1.2.0")
+	run("tag", "v1.2.0")
+
+	config := &cfg.Config{ProjectPath: t.TempDir()}
+	source := "git::file://" + filepath.ToSlash(repo) + "//modules/x?ref=v1.1.0"
+	tmpl, err := Load(config, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tmpl.Files, []string{"main.tf"}) || tmpl.Remote.Ref != "v1.1.0" {
+		t.Fatalf("Load(%s) = %v, ref %s", source, tmpl.Files, tmpl.Remote.Ref)
+	}
+	if data, _ := os.ReadFile(filepath.Join(tmpl.Root, "main.tf")); string(data) != "# v1.1.0" {
+		t.Errorf("main.tf of %s = %q", source, data)
+	}
+	if latest, err := Latest(config, source); err != nil || latest != "v1.2.0" {
+		t.Errorf("Latest(%s) = %q, %v, want v1.2.0", source, latest, err)
+	}
+	if _, err := Resolve(config, "git::file://"+filepath.ToSlash(repo)+"//missing?ref=v1.1.0"); err == nil {
+		t.Error("Resolve of a missing folder is not an error")
+	}
+}
+
+// writes the files (relative path to content) under the folder
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"vdex/codec"
+	cfg "vdex/config"
+	parcer "vdex/parser"
+)
+
+// extension of the terraform files that are parsed for REPLACE-ME values
+const TF_EXT = ".tf"
+
+// extensions of the other files of a template that are copied as is (eg: user_data.tpl, policy.json),
+// other files such as READMEs are not part of the rendered files
+var ASSET_EXTS = []string{".tfvars", ".tpl", ".tftpl", ".json"}
+
+// separates the file name from the key when a key is found in more than one file
+const FILE_KEY_SEP = ":"
+
+// structure holds the files of a template
+type Template struct {
+	// source of the template as configured - a file, a directory or a glob pattern
+	Source string
+	// root directory of the template, rendered files keep the layout relative to it
+	Root string
+	// terraform files, relative to Root
+	Files []string
+	// other files (eg: .tpl, .json) copied as is, relative to Root
+	Assets []string
+	// remote source after it is fetched, nil for local sources
+	Remote *Resolved
+	// keys found in more than one file, such keys are qualified with the file name
+	collisions map[string]bool
+	// parsed terraform files, in the order of Files
+	docs []*parcer.Document
+}
+
+// returns true if the pattern has glob meta characters
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// returns the directory part of the glob pattern that has no meta characters
+func globRoot(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for isGlob(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// files that are never part of a template, hidden files (eg: .gitignore, editor swap files) included
+func skipFile(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), ".") || strings.HasSuffix(name, ".tfstate") || strings.HasSuffix(name, ".tfstate.backup")
+}
+
+// returns true if the file is copied with the rendered files
+func isAsset(name string) bool {
+	return slices.Contains(ASSET_EXTS, filepath.Ext(name))
+}
+
+/*
+ * Resolves the template source - a single terraform file, a directory, a glob pattern
+ * or a remote (git:: or registry::) source
+ * Directories are walked recursively, hidden directories (.terraform, .cache, .git) and
+ * the config folder are skipped
+ * Returns the template, error if the source has no terraform files
+ */
+func Load(config *cfg.Config, source string) (*Template, error) {
+	t := Template{Source: source}
+
+	log.Printf("\nIn template Load %s", source)
+	if IsRemote(source) {
+		remote, err := Resolve(config, source)
+		if err != nil {
+			log.Println("Failed to fetch the template", source, err)
+			return nil, err
+		}
+		t.Remote = remote
+		source = remote.Dir
+	}
+
+	add := func(rel string) {
+		if skipFile(rel) {
+			return
+		}
+		if filepath.Ext(rel) == TF_EXT {
+			t.Files = append(t.Files, filepath.ToSlash(rel))
+		} else if isAsset(rel) {
+			t.Assets = append(t.Assets, filepath.ToSlash(rel))
+		} else {
+			log.Println("Skipping the template file", rel)
+		}
+	}
+
+	info, err := os.Stat(source)
+	switch {
+	case err == nil && info.IsDir():
+		t.Root = source
+		confPath, _ := filepath.Abs(config.ConfPath)
+		err = filepath.WalkDir(source, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				abs, _ := filepath.Abs(p)
+				if p != source && (strings.HasPrefix(d.Name(), ".") || abs == confPath) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			rel, err := filepath.Rel(source, p)
+			if err != nil {
+				return err
+			}
+			add(rel)
+			return nil
+		})
+		if err != nil {
+			log.Println("Failed to read the template directory", source, err)
+			return nil, err
+		}
+	case err == nil:
+		t.Root = filepath.Dir(source)
+		t.Files = append(t.Files, filepath.Base(source))
+	case isGlob(source):
+		t.Root = globRoot(source)
+		matches, err := filepath.Glob(source)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || info.IsDir() {
+				continue
+			}
+			rel, err := filepath.Rel(t.Root, m)
+			if err != nil {
+				return nil, err
+			}
+			add(rel)
+		}
+	default:
+		log.Println("Failed to access the template", source, err)
+		return nil, err
+	}
+
+	if len(t.Files) == 0 {
+		return nil, fmt.Errorf("no terraform files found in the template %s", source)
+	}
+	sort.Strings(t.Files)
+	sort.Strings(t.Assets)
+	return &t, nil
+}
+
+/*
+ * Returns true if the file (relative to the root) is a terraform file of the template
+ */
+func (t *Template) HasFile(name string) bool {
+	for _, f := range t.Files {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Returns the checksum of the terraform files and the assets of the template
+ * the checksum of the fetched folder is returned for remote templates
+ */
+func (t *Template) Checksum() (string, error) {
+	if t.Remote != nil {
+		return t.Remote.Checksum, nil
+	}
+	return checksumFiles(t.Root, append(append([]string(nil), t.Files...), t.Assets...))
+}
+
+// returns the config key of the param key found in the file
+func (t *Template) configKey(file string, key string) string {
+	if t.collisions[key] {
+		return file + FILE_KEY_SEP + key
+	}
+	return key
+}
+
+/*
+ * Parses all the terraform files of the template and collects the REPLACE-ME params
+ * Keys found in more than one file are qualified with the file name (eg: providers.tf:provider "aws".region)
+ * Returns the merged parsed blocks
+ */
+func (t *Template) Parse() (*parcer.TFBlocks, error) {
+	var merged parcer.TFBlocks
+	merged.Init()
+
+	t.docs = make([]*parcer.Document, len(t.Files))
+	count := make(map[string]int)
+	for i, f := range t.Files {
+		doc, err := parseFile(filepath.Join(t.Root, f))
+		if err != nil {
+			log.Println("Failed to parse file:", f)
+			return nil, err
+		}
+		t.docs[i] = doc
+		for k := range doc.Params {
+			count[k]++
+		}
+	}
+
+	t.collisions = make(map[string]bool)
+	for k, c := range count {
+		if c > 1 {
+			t.collisions[k] = true
+		}
+	}
+
+	for i, f := range t.Files {
+		doc := t.docs[i]
+		merged.TFList = append(merged.TFList, doc.Blocks...)
+		merged.MList = append(merged.MList, doc.Modules...)
+		for k, v := range doc.Params {
+			merged.Param[t.configKey(f, k)] = v
+			merged.Schema[t.configKey(f, k)] = v
+		}
+	}
+	return &merged, nil
+}
+
+// parses the terraform file
+func parseFile(name string) (*parcer.Document, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parcer.Parse(file, name)
+}
+
+/*
+ * Renders the template into outDir with the values of the config, the layout of the files is preserved
+ * varRefs renders the REPLACE-ME params as variable references instead of the values
+ * Returns
+ * the merged parsed blocks, Schema holds the REPLACE-ME params by the config key
+ * list of the generated files
+ * error: if any failure
+ */
+func (t *Template) Render(values map[string]string, outDir string, varRefs bool) (*parcer.TFBlocks, []string, error) {
+	var fileList []string
+
+	merged, err := t.Parse()
+	if err != nil {
+		return nil, fileList, err
+	}
+
+	// all the files are rendered before any is written, no file is written if one can not be rendered
+	rendered := make([]bytes.Buffer, len(t.Files))
+	for i, f := range t.Files {
+		file := f
+		opts := parcer.RenderOptions{
+			VarRefs: varRefs,
+			KeyFunc: func(key string) string {
+				return t.configKey(file, key)
+			},
+		}
+		if err := parcer.RenderWith(t.docs[i], values, &rendered[i], opts); err != nil {
+			log.Println("Failed to render file:", f)
+			return nil, fileList, err
+		}
+	}
+
+	for i, f := range t.Files {
+		outFile := filepath.Join(outDir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+			log.Println("Failed to create directory", filepath.Dir(outFile))
+			return nil, fileList, err
+		}
+		if err := os.WriteFile(outFile, rendered[i].Bytes(), 0666); err != nil {
+			log.Println("Failed to write file:", outFile)
+			return nil, fileList, err
+		}
+		fileList = append(fileList, outFile)
+	}
+
+	for _, a := range t.Assets {
+		outFile := filepath.Join(outDir, filepath.FromSlash(a))
+		if err := copyFile(filepath.Join(t.Root, a), outFile); err != nil {
+			log.Println("Failed to copy file:", a, err)
+			return nil, fileList, err
+		}
+		fileList = append(fileList, outFile)
+	}
+	return merged, fileList, nil
+}
+
+// copies the file, parent directories are created if needed
+func copyFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// name of the optional settings file in the system folder
+const SYSTEM_FILE = ".vdex"
+
+/*
+ * Returns the template source of the system
+ * template setting of the config takes precedence over the .vdex file of the system folder,
+ * the project template is used otherwise. Relative paths are relative to the system folder
+ */
+func SystemSource(config *cfg.Config, teamCfgPath string, values map[string]string) string {
+	source := strings.Trim(SystemSetting(teamCfgPath, values, cfg.TEMPLATE_KEY), "\"")
+	if source == "" {
+		return config.Modfile
+	}
+	if filepath.IsAbs(source) || IsRemote(source) {
+		return source
+	}
+	return filepath.Join(teamCfgPath, filepath.FromSlash(source))
+}
+
+/*
+ * Returns the setting of the system (eg: template, depends_on)
+ * the setting of the config takes precedence over the .vdex file of the system folder
+ */
+func SystemSetting(teamCfgPath string, values map[string]string, key string) string {
+	if v := values[key]; strings.Trim(v, "\"") != "" {
+		return v
+	}
+	if data, err := os.ReadFile(filepath.Join(teamCfgPath, SYSTEM_FILE)); err == nil {
+		settings, _ := codec.TextCodec{}.Decode(data)
+		return settings[key]
+	}
+	return ""
+}
+
+/*
+ * Returns the template source relative to the system folder as recorded in the config
+ */
+func RelativeSource(teamCfgPath string, source string) string {
+	if IsRemote(source) {
+		return source
+	}
+	absPath, err1 := filepath.Abs(teamCfgPath)
+	absSource, err2 := filepath.Abs(source)
+	if err1 != nil || err2 != nil {
+		return filepath.ToSlash(source)
+	}
+	rel, err := filepath.Rel(absPath, absSource)
+	if err != nil {
+		return filepath.ToSlash(absSource)
+	}
+	return filepath.ToSlash(rel)
+}
+
+/*
+ * Returns a warning for each reference of a REPLACE-ME value to a block that is not declared
+ * in the template (eg: var.region without variable "region")
+ * values: config values by key, the default of the template is checked for a key without value
+ */
+func ReferenceWarnings(tfbs *parcer.TFBlocks, values map[string]string) []string {
+	var warnings []string
+	for _, key := range codec.SortKeys(tfbs.Schema) {
+		value, found := values[key]
+		if !found {
+			value = tfbs.Schema[key].P_value
+		}
+		for _, ref := range tfbs.Undeclared(value) {
+			warnings = append(warnings, fmt.Sprintf("%s references %s which is not declared in the template", key, ref))
+		}
+	}
+	return warnings
+}
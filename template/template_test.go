@@ -0,0 +1,111 @@
+package template
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	cfg "vdex/config"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.tf":                 "",
+		"variables.tf":            "",
+		"user_data.tpl":           "",
+		"README.md":               "",
+		".hidden.tf":              "",
+		"network/vpc.tf":          "",
+		"network/policy.json":     "",
+		"iam/roles.tf":            "",
+		".terraform/modules/m.tf": "",
+		"src/app/config.txt":      "",
+		"src/app/main.tf":         "",
+	})
+	config := &cfg.Config{ConfPath: filepath.Join(dir, "src")}
+
+	tests := []struct {
+		name   string
+		source string
+		root   string
+		files  []string
+		assets []string
+	}{
+		{"file", "main.tf", "", []string{"main.tf"}, nil},
+		{"directory", "", "", []string{"iam/roles.tf", "main.tf", "network/vpc.tf", "variables.tf"}, []string{"network/policy.json", "user_data.tpl"}},
+		{"sub directory", "network", "network", []string{"vpc.tf"}, []string{"policy.json"}},
+		{"glob", "*.tf", "", []string{"main.tf", "variables.tf"}, nil},
+		{"glob of files", "*", "", []string{"main.tf", "variables.tf"}, []string{"user_data.tpl"}},
+		{"glob of folders", "*/*.tf", "", []string{"iam/roles.tf", "network/vpc.tf"}, nil},
+		{"glob in a folder", "network/*", "network", []string{"vpc.tf"}, []string{"policy.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Load(config, filepath.Join(dir, tt.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.root); tmpl.Root != want {
+				t.Errorf("Root = %s, want %s", tmpl.Root, want)
+			}
+			if !slices.Equal(tmpl.Files, tt.files) {
+				t.Errorf("Files = %v, want %v", tmpl.Files, tt.files)
+			}
+			if !slices.Equal(tmpl.Assets, tt.assets) {
+				t.Errorf("Assets = %v, want %v", tmpl.Assets, tt.assets)
+			}
+		})
+	}
+
+	for _, source := range []string{"missing.tf", "*.hcl", "network/*.json"} {
+		if _, err := Load(config, filepath.Join(dir, source)); err == nil {
+			t.Errorf("Load(%s) is not an error", source)
+		}
+	}
+}
+
+func TestRelativeSource(t *testing.T) {
+	dir := t.TempDir()
+	sysPath := filepath.Join(dir, "src", "app")
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{filepath.Join(dir, "main.tf"), "../../main.tf"},
+		{filepath.Join(dir, "templates", "*.tf"), "../../templates/*.tf"},
+		{filepath.Join(sysPath, "main.tf"), "main.tf"},
+		{"git::file:///srv/git/templates//modules/x?ref=v1.1.0", "git::file:///srv/git/templates//modules/x?ref=v1.1.0"},
+		{"registry::app@1.2.0", "registry::app@1.2.0"},
+	}
+	for _, tt := range tests {
+		if got := RelativeSource(sysPath, tt.source); got != tt.want {
+			t.Errorf("RelativeSource(%s) = %s, want %s", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestSystemSource(t *testing.T) {
+	dir := t.TempDir()
+	sysPath := filepath.Join(dir, "src", "app")
+	writeFiles(t, filepath.Join(dir, "src", "web"), map[string]string{SYSTEM_FILE: "template = ../../web.tf\n"})
+	config := &cfg.Config{Modfile: "main.tf"}
+
+	tests := []struct {
+		name    string
+		sysPath string
+		values  map[string]string
+		want    string
+	}{
+		{"project template", sysPath, nil, "main.tf"},
+		{"relative", sysPath, map[string]string{cfg.TEMPLATE_KEY: "../../templates"}, filepath.Join(dir, "templates")},
+		{"quoted", sysPath, map[string]string{cfg.TEMPLATE_KEY: `"../../*.tf"`}, filepath.Join(dir, "*.tf")},
+		{"absolute", sysPath, map[string]string{cfg.TEMPLATE_KEY: "/srv/templates/app"}, "/srv/templates/app"},
+		{"remote", sysPath, map[string]string{cfg.TEMPLATE_KEY: "git::file:///srv/git/templates//modules/x?ref=v1.1.0"}, "git::file:///srv/git/templates//modules/x?ref=v1.1.0"},
+		{"system file", filepath.Join(dir, "src", "web"), nil, filepath.Join(dir, "web.tf")},
+	}
+	for _, tt := range tests {
+		if got := SystemSource(config, tt.sysPath, tt.values); got != tt.want {
+			t.Errorf("%s: SystemSource() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}